@@ -56,6 +56,7 @@ VFS-mounted storage backends (SQLite, S3, PostgreSQL, ephemeral, etc.)`,
 
 			interactive, _ := cmd.Flags().GetBool("interactive")
 			disasm, _ := cmd.Flags().GetBool("disasm")
+			strict, _ := cmd.Flags().GetBool("strict")
 
 			var bytecode *compiler.ByteCode
 
@@ -65,26 +66,40 @@ VFS-mounted storage backends (SQLite, S3, PostgreSQL, ephemeral, etc.)`,
 					return fmt.Errorf("failed to read file: %w", err)
 				}
 
-				bytecode, err = compile(string(content))
+				bytecode, err = compile(string(content), strict)
 				if err != nil {
 					return err
 				}
 			}
 
 			if command, _ := cmd.Flags().GetString("command"); command != "" {
-				bytecode, err = compile(command)
+				bytecode, err = compile(command, strict)
 				if err != nil {
 					return err
 				}
 			}
 
 			trace, _ := cmd.Flags().GetBool("trace")
+			traceGrowth := func(g vm.ArenaGrowth) {
+				fmt.Fprintf(os.Stderr, "line %d: alloc block grew from %d to %d bytes (ceiling %d)\n", g.Line, g.From, g.To, g.Ceiling)
+			}
 
 			vm := vm.NewVM(fs)
 			// defer vm.Shutdown()
 
+			if maxAlloc, _ := cmd.Flags().GetInt("max-alloc"); maxAlloc > 0 {
+				vm.MaxAllocSize(maxAlloc)
+			}
+			if sanitize, _ := cmd.Flags().GetBool("sanitize"); sanitize {
+				vm.SetSanitize(true)
+			}
+			if leaks, _ := cmd.Flags().GetBool("leaks"); leaks {
+				vm.SetLeakCheck(true)
+			}
+
 			if trace {
 				// vm.EnableTrace()
+				vm.OnArenaGrowth(traceGrowth)
 			}
 
 			if bytecode != nil {
@@ -119,13 +134,17 @@ VFS-mounted storage backends (SQLite, S3, PostgreSQL, ephemeral, etc.)`,
 	cmd.Flags().StringP("script", "s", "", "Execute a Vega script file")
 	cmd.Flags().BoolP("disasm", "d", false, "Show disassembled bytecode (debug)")
 	cmd.Flags().BoolP("trace", "t", false, "Enable execution tracing (shown on error)")
+	cmd.Flags().Bool("strict", false, "Fail on lossy numeric conversions instead of truncating, and on lifetime errors found on every path")
+	cmd.Flags().Int("max-alloc", vm.DefaultMaxAllocSize, "Limit in bytes for the combined capacity of all live alloc blocks")
+	cmd.Flags().Bool("sanitize", false, "Track memory ownership and fail pointer alias accesses to freed or unowned bytes (debug)")
+	cmd.Flags().Bool("leaks", false, "Report variables still allocated when an alloc block exits (errors with --strict)")
 	// Set version used by './vega version'
 	cmd.Version = fmt.Sprintf("%s.%s", info.Version, info.Commit)
 
 	return cmd
 }
 
-func compile(input string) (*compiler.ByteCode, error) {
+func compile(input string, strict bool) (*compiler.ByteCode, error) {
 	l, err := lexer.NewLexer(input)
 	if err != nil {
 		return nil, fmt.Errorf("syntax error: %w", err)
@@ -142,10 +161,14 @@ func compile(input string) (*compiler.ByteCode, error) {
 	}
 
 	c := compiler.NewCompiler()
+	c.SetStrict(strict)
 	bytecode, err := c.Compile(program)
 	if err != nil {
 		return nil, fmt.Errorf("compile error: %w", err)
 	}
+	for _, d := range bytecode.Diagnostics {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", d)
+	}
 
 	return bytecode, nil
 }
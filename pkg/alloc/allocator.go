@@ -1,6 +1,87 @@
 package alloc
 
-import "fmt"
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrFreeUnsupported is returned by Free when the strategy cannot release
+// the region, such as a bump allocator asked to free below its top.
+var ErrFreeUnsupported = errors.New("free not supported")
+
+// Allocator manages a []byte backing store. The runtime addresses every
+// region by its offset, so it does not care which strategy hands them out.
+type Allocator interface {
+	// Alloc reserves size bytes and returns their offset in the buffer.
+	Alloc(size int) (int, error)
+	// Free releases the region at [offset, offset+size) and zeroes it.
+	Free(offset, size int) error
+	Slice(offset, size int) []byte
+	Write(offset int, data []byte)
+	Read(offset, size int) []byte
+	Capacity() int
+	FreeSpace() int
+	// Grow moves the contents into a new, larger buffer of the given
+	// capacity. Offsets stay valid; slices taken before still view the old
+	// buffer and must be taken again.
+	Grow(capacity int) error
+	// Clone returns an independent copy of the buffer and the bookkeeping,
+	// which the runtime keeps to roll an atomic block back.
+	Clone() Allocator
+	// MarshalBinary encodes the buffer and the bookkeeping, which the
+	// runtime writes to the file of a persistent arena. UnmarshalBinary
+	// replaces both with the encoded ones; a pool keeps its slot size.
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// Strategy selects the Allocator implementation of an alloc block.
+type Strategy byte
+
+const (
+	StrategyFreeList Strategy = iota // first-fit free list with coalescing (default)
+	StrategyBump                     // linear pointer advance, released as a whole
+	StrategyPool                     // fixed-size slots
+)
+
+var strategyNames = map[Strategy]string{
+	StrategyFreeList: "freelist",
+	StrategyBump:     "bump",
+	StrategyPool:     "pool",
+}
+
+func (s Strategy) String() string {
+	if name, ok := strategyNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Strategy(%d)", byte(s))
+}
+
+// StrategyForName resolves the name used in 'alloc 64 :bump' to a Strategy.
+func StrategyForName(name string) (Strategy, bool) {
+	for s, n := range strategyNames {
+		if n == name {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// New creates an allocator of the given strategy and capacity. slotSize is
+// the slot size of a pool and ignored by the other strategies.
+func New(strategy Strategy, capacity, slotSize int) (Allocator, error) {
+	switch strategy {
+	case StrategyFreeList:
+		return NewAllocator(capacity), nil
+	case StrategyBump:
+		return NewBump(capacity), nil
+	case StrategyPool:
+		return NewPool(capacity, slotSize)
+	}
+	return nil, fmt.Errorf("unknown allocator strategy %d", byte(strategy))
+}
 
 // FreeBlock represents a contiguous free region in the byte buffer.
 type FreeBlock struct {
@@ -8,16 +89,17 @@ type FreeBlock struct {
 	Size   int
 }
 
-// Allocator manages a []byte backing store with a free list for allocation and deallocation.
-type Allocator struct {
+// FreeList hands out regions first-fit from a free list and coalesces
+// adjacent free blocks on release.
+type FreeList struct {
 	buffer   []byte
 	freeList []FreeBlock // sorted by offset
 }
 
-// NewAllocator creates an Allocator with the given byte capacity.
+// NewAllocator creates a FreeList with the given byte capacity.
 // The entire buffer starts as one free block.
-func NewAllocator(capacity int) *Allocator {
-	return &Allocator{
+func NewAllocator(capacity int) *FreeList {
+	return &FreeList{
 		buffer: make([]byte, capacity),
 		freeList: []FreeBlock{
 			{
@@ -30,7 +112,7 @@ func NewAllocator(capacity int) *Allocator {
 
 // Alloc finds the first free block that can fit size bytes (first-fit),
 // splits if larger, and returns the offset into the buffer.
-func (a *Allocator) Alloc(size int) (int, error) {
+func (a *FreeList) Alloc(size int) (int, error) {
 	for i, block := range a.freeList {
 		if block.Size >= size {
 			offset := block.Offset
@@ -52,7 +134,7 @@ func (a *Allocator) Alloc(size int) (int, error) {
 
 // Free returns the region at [offset, offset+size) back to the free list.
 // The memory is zeroed and coalesced with adjacent free blocks.
-func (a *Allocator) Free(offset, size int) {
+func (a *FreeList) Free(offset, size int) error {
 	// Zero the freed memory
 	for i := offset; i < offset+size; i++ {
 		a.buffer[i] = 0
@@ -91,33 +173,80 @@ func (a *Allocator) Free(offset, size int) {
 			a.freeList = append(a.freeList[:insertIdx], a.freeList[insertIdx+1:]...)
 		}
 	}
+	return nil
 }
 
 // Slice returns a writable view of the buffer at [offset, offset+size).
-func (a *Allocator) Slice(offset, size int) []byte {
+func (a *FreeList) Slice(offset, size int) []byte {
 	return a.buffer[offset : offset+size]
 }
 
 // Write copies data into the buffer at the given offset.
-func (a *Allocator) Write(offset int, data []byte) {
+func (a *FreeList) Write(offset int, data []byte) {
 	copy(a.buffer[offset:], data)
 }
 
 // Read returns a slice view of the buffer at [offset, offset+size).
-func (a *Allocator) Read(offset, size int) []byte {
+func (a *FreeList) Read(offset, size int) []byte {
 	return a.buffer[offset : offset+size]
 }
 
 // Capacity returns the total size of the backing buffer.
-func (a *Allocator) Capacity() int {
+func (a *FreeList) Capacity() int {
 	return len(a.buffer)
 }
 
 // FreeSpace returns the total number of free bytes across all free blocks.
-func (a *Allocator) FreeSpace() int {
+func (a *FreeList) FreeSpace() int {
 	total := 0
 	for _, block := range a.freeList {
 		total += block.Size
 	}
 	return total
 }
+
+// Grow extends the buffer to capacity bytes. The new bytes become a free
+// block, merged with a free block at the old end of the buffer.
+func (a *FreeList) Grow(capacity int) error {
+	old := len(a.buffer)
+	if err := growBuffer(&a.buffer, capacity); err != nil {
+		return err
+	}
+	if n := len(a.freeList); n > 0 && a.freeList[n-1].Offset+a.freeList[n-1].Size == old {
+		a.freeList[n-1].Size += capacity - old
+		return nil
+	}
+	a.freeList = append(a.freeList, FreeBlock{Offset: old, Size: capacity - old})
+	return nil
+}
+
+// Clone implements Allocator.
+func (a *FreeList) Clone() Allocator {
+	return &FreeList{
+		buffer:   cloneBuffer(a.buffer),
+		freeList: slices.Clone(a.freeList),
+	}
+}
+
+// cloneBuffer copies buffer with a capacity of exactly its length. The
+// runtime finds the values that view a buffer by their capacity reaching its
+// end, which spare capacity, as slices.Clone may leave, would break.
+func cloneBuffer(buffer []byte) []byte {
+	clone := make([]byte, len(buffer))
+	copy(clone, buffer)
+	return clone
+}
+
+// growBuffer replaces *buffer with a zeroed buffer of capacity bytes that
+// starts with the old contents.
+func growBuffer(buffer *[]byte, capacity int) error {
+	if capacity <= len(*buffer) {
+		return fmt.Errorf("cannot grow buffer of %d bytes to %d", len(*buffer), capacity)
+	}
+	grown := make([]byte, capacity)
+	copy(grown, *buffer)
+	*buffer = grown
+	return nil
+}
+
+var _ Allocator = (*FreeList)(nil)
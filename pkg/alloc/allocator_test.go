@@ -216,3 +216,68 @@ func TestFreeZerosMemory(t *testing.T) {
 		}
 	}
 }
+
+func TestGrowExtendsTrailingFreeBlock(t *testing.T) {
+	a := alloc.NewAllocator(8)
+
+	off1, _ := a.Alloc(4)
+	a.Write(off1, []byte{1, 2, 3, 4})
+
+	if err := a.Grow(16); err != nil {
+		t.Fatalf("grow: %v", err)
+	}
+	if a.Capacity() != 16 || a.FreeSpace() != 12 {
+		t.Errorf("capacity = %d, free space = %d, want 16 and 12", a.Capacity(), a.FreeSpace())
+	}
+	if got := a.Read(off1, 4); got[3] != 4 {
+		t.Errorf("data after grow = %v, want [1 2 3 4]", got)
+	}
+
+	// The old tail and the new bytes form one block
+	off, err := a.Alloc(12)
+	if err != nil {
+		t.Fatalf("alloc 12 after grow: %v", err)
+	}
+	if off != 4 {
+		t.Errorf("offset after grow = %d, want 4", off)
+	}
+
+	if err := a.Grow(8); err == nil {
+		t.Error("shrinking grow succeeded")
+	}
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+	for _, strategy := range []alloc.Strategy{alloc.StrategyFreeList, alloc.StrategyBump, alloc.StrategyPool} {
+		a, _ := alloc.New(strategy, 16, 4)
+		off, _ := a.Alloc(4)
+		a.Write(off, []byte{1, 2, 3, 4})
+
+		clone := a.Clone()
+		a.Write(off, []byte{9, 9, 9, 9})
+		a.Alloc(4)
+
+		if got := clone.Read(off, 4); got[0] != 1 || got[3] != 4 {
+			t.Errorf("%s: clone bytes = %v, want [1 2 3 4]", strategy, got)
+		}
+		if clone.FreeSpace() != 12 {
+			t.Errorf("%s: clone free space = %d, want 12", strategy, clone.FreeSpace())
+		}
+		// The clone hands out the region the original took after cloning
+		if next, err := clone.Alloc(4); err != nil || next != 4 {
+			t.Errorf("%s: clone alloc = %d, %v, want offset 4", strategy, next, err)
+		}
+	}
+}
+
+func TestCloneHasExactCapacity(t *testing.T) {
+	for _, strategy := range []alloc.Strategy{alloc.StrategyFreeList, alloc.StrategyBump, alloc.StrategyPool} {
+		a, _ := alloc.New(strategy, 100, 4)
+		clone := a.Clone()
+
+		// Views are matched to their buffer by their capacity reaching its end
+		if view := clone.Slice(0, 4); cap(view) != clone.Capacity() {
+			t.Errorf("%s: view capacity = %d, want %d", strategy, cap(view), clone.Capacity())
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package alloc
+
+import "fmt"
+
+// Bump hands out regions by advancing a pointer through the buffer. Only the
+// most recent allocation can be freed, which rewinds the pointer; everything
+// else is released as a whole when the arena is discarded.
+type Bump struct {
+	buffer []byte
+	top    int // offset of the first unallocated byte
+}
+
+// NewBump creates a Bump allocator with the given byte capacity.
+func NewBump(capacity int) *Bump {
+	return &Bump{
+		buffer: make([]byte, capacity),
+	}
+}
+
+// Alloc returns the current top and advances it by size bytes.
+func (a *Bump) Alloc(size int) (int, error) {
+	if a.top+size > len(a.buffer) {
+		return 0, fmt.Errorf("out of memory: need %d bytes, have %d free", size, a.FreeSpace())
+	}
+	offset := a.top
+	a.top += size
+	return offset, nil
+}
+
+// Free rewinds the top when [offset, offset+size) is the most recent
+// allocation, so block locals and function frames released in reverse order
+// are reclaimed. Any other region returns ErrFreeUnsupported.
+func (a *Bump) Free(offset, size int) error {
+	if offset+size != a.top {
+		return fmt.Errorf("bump allocator can only free its most recent allocation: %w", ErrFreeUnsupported)
+	}
+	clear(a.buffer[offset : offset+size])
+	a.top = offset
+	return nil
+}
+
+// Slice returns a writable view of the buffer at [offset, offset+size).
+func (a *Bump) Slice(offset, size int) []byte {
+	return a.buffer[offset : offset+size]
+}
+
+// Write copies data into the buffer at the given offset.
+func (a *Bump) Write(offset int, data []byte) {
+	copy(a.buffer[offset:], data)
+}
+
+// Read returns a slice view of the buffer at [offset, offset+size).
+func (a *Bump) Read(offset, size int) []byte {
+	return a.buffer[offset : offset+size]
+}
+
+// Capacity returns the total size of the backing buffer.
+func (a *Bump) Capacity() int {
+	return len(a.buffer)
+}
+
+// FreeSpace returns the number of bytes above the top.
+func (a *Bump) FreeSpace() int {
+	return len(a.buffer) - a.top
+}
+
+// Grow extends the buffer to capacity bytes above the top.
+func (a *Bump) Grow(capacity int) error {
+	return growBuffer(&a.buffer, capacity)
+}
+
+// Clone implements Allocator.
+func (a *Bump) Clone() Allocator {
+	return &Bump{
+		buffer: cloneBuffer(a.buffer),
+		top:    a.top,
+	}
+}
+
+var _ Allocator = (*Bump)(nil)
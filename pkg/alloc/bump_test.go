@@ -0,0 +1,55 @@
+package alloc_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mwantia/vega/pkg/alloc"
+)
+
+func TestBumpSequentialAlloc(t *testing.T) {
+	a := alloc.NewBump(16)
+
+	for _, tc := range []struct{ size, want int }{{4, 0}, {8, 4}, {4, 12}} {
+		off, err := a.Alloc(tc.size)
+		if err != nil {
+			t.Fatalf("alloc %d: %v", tc.size, err)
+		}
+		if off != tc.want {
+			t.Errorf("alloc %d offset = %d, want %d", tc.size, off, tc.want)
+		}
+	}
+
+	if _, err := a.Alloc(1); err == nil {
+		t.Fatal("expected OOM error, got nil")
+	}
+}
+
+func TestBumpFreeRewindsTop(t *testing.T) {
+	a := alloc.NewBump(8)
+
+	off1, _ := a.Alloc(4)
+	off2, _ := a.Alloc(4)
+	a.Write(off2, []byte{1, 2, 3, 4})
+
+	if err := a.Free(off2, 4); err != nil {
+		t.Fatalf("free most recent: %v", err)
+	}
+	if a.FreeSpace() != 4 {
+		t.Errorf("free space after rewind = %d, want 4", a.FreeSpace())
+	}
+	for i, b := range a.Read(off2, 4) {
+		if b != 0 {
+			t.Errorf("byte %d = %d after free, want 0", i, b)
+		}
+	}
+
+	off3, _ := a.Alloc(4)
+	if off3 != off2 {
+		t.Errorf("offset after rewind = %d, want %d", off3, off2)
+	}
+
+	if err := a.Free(off1, 4); !errors.Is(err, alloc.ErrFreeUnsupported) {
+		t.Errorf("free below top = %v, want ErrFreeUnsupported", err)
+	}
+}
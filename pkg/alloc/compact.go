@@ -0,0 +1,69 @@
+package alloc
+
+// Region is an allocated range [Offset, Offset+Size) of a buffer.
+type Region struct {
+	Offset int
+	Size   int
+}
+
+// Compactor is implemented by allocators whose free space can fragment and
+// whose regions may be moved by their owner. The pool has no such need,
+// since any free slot fits any request.
+type Compactor interface {
+	// Compact slides the live regions, sorted by offset and not
+	// overlapping, to the positions returned by Pack and frees everything
+	// after them as one zeroed block. Regions that are not listed are
+	// released.
+	Compact(live []Region) []Region
+}
+
+// Pack returns where Compact moves each of the sorted live regions: back to
+// back from offset 0, in their original order.
+func Pack(live []Region) []Region {
+	packed := make([]Region, len(live))
+	top := 0
+	for i, region := range live {
+		packed[i] = Region{Offset: top, Size: region.Size}
+		top += region.Size
+	}
+	return packed
+}
+
+// slide moves the live regions of buffer to their packed positions, zeroes
+// the rest and returns the offset of the first free byte. Regions only move
+// towards the start, so copying them in order never overwrites one that is
+// still to be moved.
+func slide(buffer []byte, live []Region) ([]Region, int) {
+	packed := Pack(live)
+	top := 0
+	for i, region := range live {
+		copy(buffer[packed[i].Offset:], buffer[region.Offset:region.Offset+region.Size])
+		top = packed[i].Offset + region.Size
+	}
+	clear(buffer[top:])
+	return packed, top
+}
+
+// Compact implements Compactor. The free list becomes a single block after
+// the last live region.
+func (a *FreeList) Compact(live []Region) []Region {
+	packed, top := slide(a.buffer, live)
+	a.freeList = a.freeList[:0]
+	if top < len(a.buffer) {
+		a.freeList = append(a.freeList, FreeBlock{Offset: top, Size: len(a.buffer) - top})
+	}
+	return packed
+}
+
+// Compact implements Compactor. The top rewinds to the end of the last live
+// region, which also reclaims regions the runtime could not free.
+func (a *Bump) Compact(live []Region) []Region {
+	packed, top := slide(a.buffer, live)
+	a.top = top
+	return packed
+}
+
+var (
+	_ Compactor = (*FreeList)(nil)
+	_ Compactor = (*Bump)(nil)
+)
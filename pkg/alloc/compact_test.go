@@ -0,0 +1,63 @@
+package alloc_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mwantia/vega/pkg/alloc"
+)
+
+func TestCompactMergesHoles(t *testing.T) {
+	a := alloc.NewAllocator(16)
+
+	off1, _ := a.Alloc(4)
+	off2, _ := a.Alloc(4)
+	off3, _ := a.Alloc(4)
+	off4, _ := a.Alloc(4)
+	a.Write(off2, []byte{1, 2, 3, 4})
+	a.Write(off4, []byte{5, 6, 7, 8})
+	a.Free(off1, 4)
+	a.Free(off3, 4)
+
+	// 8 bytes free, but in two 4-byte holes
+	if _, err := a.Alloc(8); err == nil {
+		t.Fatal("expected fragmented alloc to fail")
+	}
+
+	packed := a.Compact([]alloc.Region{{Offset: off2, Size: 4}, {Offset: off4, Size: 4}})
+	if packed[0].Offset != 0 || packed[1].Offset != 4 {
+		t.Fatalf("packed = %v, want offsets 0 and 4", packed)
+	}
+	if got := a.Read(0, 8); !bytes.Equal(got, []byte{1, 2, 3, 4, 5, 6, 7, 8}) {
+		t.Errorf("compacted bytes = %v", got)
+	}
+
+	off, err := a.Alloc(8)
+	if err != nil {
+		t.Fatalf("alloc 8 after compact: %v", err)
+	}
+	if off != 8 {
+		t.Errorf("alloc after compact offset = %d, want 8", off)
+	}
+	if got := a.Read(8, 8); !bytes.Equal(got, make([]byte, 8)) {
+		t.Errorf("free block after compact not zeroed: %v", got)
+	}
+}
+
+func TestBumpCompactRewindsTop(t *testing.T) {
+	a := alloc.NewBump(12)
+
+	a.Alloc(4)
+	off2, _ := a.Alloc(4)
+	a.Alloc(4)
+	a.Write(off2, []byte{9, 9, 9, 9})
+
+	// Only the middle region is still in use
+	a.Compact([]alloc.Region{{Offset: off2, Size: 4}})
+	if a.FreeSpace() != 8 {
+		t.Errorf("free space after compact = %d, want 8", a.FreeSpace())
+	}
+	if got := a.Read(0, 4); !bytes.Equal(got, []byte{9, 9, 9, 9}) {
+		t.Errorf("compacted bytes = %v", got)
+	}
+}
@@ -0,0 +1,169 @@
+package alloc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The binary form of an allocator is its buffer followed by its bookkeeping,
+// every number as a little-endian uint32: the capacity and the bytes of the
+// buffer, then the free blocks of a FreeList, the top of a Bump, or the slot
+// size and the free slots of a Pool in the order they are handed out.
+
+var errTruncated = errors.New("truncated allocator state")
+
+// decoder reads the numbers of an encoded allocator, remembering the first
+// error so callers check it once at the end.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) int() int {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data) < 4 {
+		d.err = errTruncated
+		return 0
+	}
+	n := binary.LittleEndian.Uint32(d.data)
+	d.data = d.data[4:]
+	return int(n)
+}
+
+// count reads the number of entries that follow, each of size bytes.
+func (d *decoder) count(size int) int {
+	n := d.int()
+	if d.err == nil && n > len(d.data)/size {
+		d.err = errTruncated
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.data) < n {
+		d.err = errTruncated
+		return nil
+	}
+	out := cloneBuffer(d.data[:n])
+	d.data = d.data[n:]
+	return out
+}
+
+// end returns the first error, or an error when bytes are left over.
+func (d *decoder) end() error {
+	if d.err == nil && len(d.data) > 0 {
+		d.err = fmt.Errorf("%d trailing bytes after allocator state", len(d.data))
+	}
+	return d.err
+}
+
+func encodeBuffer(buffer []byte, words int) []byte {
+	out := make([]byte, 0, 4+len(buffer)+4*words)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(buffer)))
+	return append(out, buffer...)
+}
+
+func appendInt(out []byte, n int) []byte {
+	return binary.LittleEndian.AppendUint32(out, uint32(n))
+}
+
+// MarshalBinary implements Allocator.
+func (a *FreeList) MarshalBinary() ([]byte, error) {
+	out := encodeBuffer(a.buffer, 1+2*len(a.freeList))
+	out = appendInt(out, len(a.freeList))
+	for _, block := range a.freeList {
+		out = appendInt(out, block.Offset)
+		out = appendInt(out, block.Size)
+	}
+	return out, nil
+}
+
+// UnmarshalBinary implements Allocator. The free blocks must be sorted, not
+// overlap and lie inside the buffer.
+func (a *FreeList) UnmarshalBinary(data []byte) error {
+	d := &decoder{data: data}
+	buffer := d.bytes(d.int())
+	freeList := make([]FreeBlock, d.count(8))
+	end := 0
+	for i := range freeList {
+		freeList[i] = FreeBlock{Offset: d.int(), Size: d.int()}
+		if d.err == nil && (freeList[i].Offset < end || freeList[i].Size <= 0 || freeList[i].Offset+freeList[i].Size > len(buffer)) {
+			d.err = fmt.Errorf("free block %d at offset %d (%d bytes) overlaps another block or lies outside the buffer", i, freeList[i].Offset, freeList[i].Size)
+		}
+		end = freeList[i].Offset + freeList[i].Size
+	}
+	if err := d.end(); err != nil {
+		return err
+	}
+	a.buffer, a.freeList = buffer, freeList
+	return nil
+}
+
+// MarshalBinary implements Allocator.
+func (a *Bump) MarshalBinary() ([]byte, error) {
+	return appendInt(encodeBuffer(a.buffer, 1), a.top), nil
+}
+
+// UnmarshalBinary implements Allocator.
+func (a *Bump) UnmarshalBinary(data []byte) error {
+	d := &decoder{data: data}
+	buffer := d.bytes(d.int())
+	top := d.int()
+	if err := d.end(); err != nil {
+		return err
+	}
+	if top > len(buffer) {
+		return fmt.Errorf("bump top %d is outside the buffer of %d bytes", top, len(buffer))
+	}
+	a.buffer, a.top = buffer, top
+	return nil
+}
+
+// MarshalBinary implements Allocator.
+func (a *Pool) MarshalBinary() ([]byte, error) {
+	out := encodeBuffer(a.buffer, 2+len(a.free))
+	out = appendInt(out, a.slotSize)
+	out = appendInt(out, len(a.free))
+	for _, index := range a.free {
+		out = appendInt(out, index)
+	}
+	return out, nil
+}
+
+// UnmarshalBinary implements Allocator. Every slot that is not free is in
+// use. The slot size must match the one the pool was created with.
+func (a *Pool) UnmarshalBinary(data []byte) error {
+	d := &decoder{data: data}
+	buffer := d.bytes(d.int())
+	slotSize := d.int()
+	if d.err == nil && slotSize != a.slotSize {
+		return fmt.Errorf("pool slot size is %d bytes, the state has %d", a.slotSize, slotSize)
+	}
+	count := len(buffer) / a.slotSize
+	used := make([]bool, count)
+	for i := range used {
+		used[i] = true
+	}
+	free := make([]int, d.count(4))
+	for i := range free {
+		free[i] = d.int()
+		if d.err == nil && (free[i] >= count || !used[free[i]]) {
+			d.err = fmt.Errorf("free pool slot %d is outside the buffer or listed twice", free[i])
+		}
+		if d.err == nil {
+			used[free[i]] = false
+		}
+	}
+	if err := d.end(); err != nil {
+		return err
+	}
+	a.buffer, a.used, a.free = buffer, used, free
+	return nil
+}
@@ -0,0 +1,79 @@
+package alloc_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mwantia/vega/pkg/alloc"
+)
+
+func TestMarshalRoundTrip(t *testing.T) {
+	for _, strategy := range []alloc.Strategy{alloc.StrategyFreeList, alloc.StrategyBump, alloc.StrategyPool} {
+		a, _ := alloc.New(strategy, 16, 4)
+		off1, _ := a.Alloc(4)
+		off2, _ := a.Alloc(4)
+		a.Write(off2, []byte{1, 2, 3, 4})
+		a.Free(off1, 4)
+
+		data, err := a.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: marshal: %v", strategy, err)
+		}
+		restored, _ := alloc.New(strategy, 0, 4)
+		if err := restored.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: unmarshal: %v", strategy, err)
+		}
+
+		if restored.Capacity() != 16 || restored.FreeSpace() != a.FreeSpace() {
+			t.Errorf("%s: capacity %d, free %d, want 16 and %d", strategy, restored.Capacity(), restored.FreeSpace(), a.FreeSpace())
+		}
+		if got := restored.Read(off2, 4); !bytes.Equal(got, []byte{1, 2, 3, 4}) {
+			t.Errorf("%s: restored bytes = %v", strategy, got)
+		}
+		// Both hand out the same region next
+		want, _ := a.Alloc(4)
+		if got, _ := restored.Alloc(4); got != want {
+			t.Errorf("%s: next alloc offset = %d, want %d", strategy, got, want)
+		}
+	}
+}
+
+func TestUnmarshalThenGrow(t *testing.T) {
+	for _, strategy := range []alloc.Strategy{alloc.StrategyFreeList, alloc.StrategyBump, alloc.StrategyPool} {
+		a, _ := alloc.New(strategy, 100, 4)
+		off, _ := a.Alloc(4)
+		a.Write(off, []byte{1, 2, 3, 4})
+		data, _ := a.MarshalBinary()
+		restored, _ := alloc.New(strategy, 0, 4)
+		if err := restored.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: unmarshal: %v", strategy, err)
+		}
+
+		// Views are matched to their buffer by their capacity reaching its end
+		if view := restored.Slice(off, 4); cap(view) != restored.Capacity()-off {
+			t.Errorf("%s: view capacity = %d, want %d", strategy, cap(view), restored.Capacity()-off)
+		}
+		if err := restored.Grow(200); err != nil {
+			t.Fatalf("%s: grow: %v", strategy, err)
+		}
+		if got := restored.Read(off, 4); !bytes.Equal(got, []byte{1, 2, 3, 4}) {
+			t.Errorf("%s: bytes after grow = %v", strategy, got)
+		}
+		if restored.Capacity() != 200 {
+			t.Errorf("%s: capacity after grow = %d, want 200", strategy, restored.Capacity())
+		}
+	}
+}
+
+func TestUnmarshalRejectsTruncatedState(t *testing.T) {
+	a := alloc.NewAllocator(16)
+	a.Alloc(4)
+	data, _ := a.MarshalBinary()
+
+	if err := alloc.NewAllocator(0).UnmarshalBinary(data[:len(data)-2]); err == nil {
+		t.Fatal("expected truncated state to fail")
+	}
+	if err := alloc.NewAllocator(0).UnmarshalBinary(append(data, 0)); err == nil {
+		t.Fatal("expected trailing bytes to fail")
+	}
+}
@@ -0,0 +1,123 @@
+package alloc
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Pool splits the buffer into fixed-size slots. Every allocation takes one
+// whole slot, so allocations larger than the slot size fail and smaller ones
+// waste the remainder. Alloc and Free are O(1).
+type Pool struct {
+	buffer   []byte
+	slotSize int
+	used     []bool // per slot
+	free     []int  // indices of free slots, lowest on top
+}
+
+// NewPool creates a Pool of capacity/slotSize slots. A remainder smaller
+// than one slot is never handed out.
+func NewPool(capacity, slotSize int) (*Pool, error) {
+	if slotSize <= 0 {
+		return nil, fmt.Errorf("pool slot size must be positive, got %d", slotSize)
+	}
+	count := capacity / slotSize
+	free := make([]int, count)
+	for i := range free {
+		free[i] = count - 1 - i
+	}
+	return &Pool{
+		buffer:   make([]byte, capacity),
+		slotSize: slotSize,
+		used:     make([]bool, count),
+		free:     free,
+	}, nil
+}
+
+// Alloc takes the lowest free slot. Zero-sized requests take no slot.
+func (a *Pool) Alloc(size int) (int, error) {
+	if size > a.slotSize {
+		return 0, fmt.Errorf("pool slot size is %d bytes, need %d", a.slotSize, size)
+	}
+	if size == 0 {
+		return 0, nil
+	}
+	n := len(a.free)
+	if n == 0 {
+		return 0, fmt.Errorf("out of memory: need %d bytes, all %d pool slots are in use", size, len(a.used))
+	}
+	index := a.free[n-1]
+	a.free = a.free[:n-1]
+	a.used[index] = true
+	return index * a.slotSize, nil
+}
+
+// Free returns the slot starting at offset to the pool and zeroes it.
+func (a *Pool) Free(offset, size int) error {
+	index := offset / a.slotSize
+	if offset%a.slotSize != 0 || index >= len(a.used) || size > a.slotSize || !a.used[index] {
+		return fmt.Errorf("invalid pool free at offset %d (%d bytes)", offset, size)
+	}
+	clear(a.buffer[offset : offset+a.slotSize])
+	a.used[index] = false
+	a.free = append(a.free, index)
+	return nil
+}
+
+// Slice returns a writable view of the buffer at [offset, offset+size).
+func (a *Pool) Slice(offset, size int) []byte {
+	return a.buffer[offset : offset+size]
+}
+
+// Write copies data into the buffer at the given offset.
+func (a *Pool) Write(offset int, data []byte) {
+	copy(a.buffer[offset:], data)
+}
+
+// Read returns a slice view of the buffer at [offset, offset+size).
+func (a *Pool) Read(offset, size int) []byte {
+	return a.buffer[offset : offset+size]
+}
+
+// Capacity returns the total size of the backing buffer.
+func (a *Pool) Capacity() int {
+	return len(a.buffer)
+}
+
+// FreeSpace returns the number of bytes in free slots.
+func (a *Pool) FreeSpace() int {
+	return len(a.free) * a.slotSize
+}
+
+// SlotSize returns the size of every pool slot.
+func (a *Pool) SlotSize() int {
+	return a.slotSize
+}
+
+// Grow extends the buffer to capacity bytes. The new slots are handed out
+// after the free slots that already exist.
+func (a *Pool) Grow(capacity int) error {
+	if err := growBuffer(&a.buffer, capacity); err != nil {
+		return err
+	}
+	count := capacity / a.slotSize
+	added := make([]int, 0, count-len(a.used))
+	for i := count - 1; i >= len(a.used); i-- {
+		added = append(added, i)
+	}
+	a.free = append(added, a.free...)
+	a.used = append(a.used, make([]bool, count-len(a.used))...)
+	return nil
+}
+
+// Clone implements Allocator.
+func (a *Pool) Clone() Allocator {
+	return &Pool{
+		buffer:   cloneBuffer(a.buffer),
+		slotSize: a.slotSize,
+		used:     slices.Clone(a.used),
+		free:     slices.Clone(a.free),
+	}
+}
+
+var _ Allocator = (*Pool)(nil)
@@ -0,0 +1,90 @@
+package alloc_test
+
+import (
+	"testing"
+
+	"github.com/mwantia/vega/pkg/alloc"
+)
+
+func TestPoolAllocAndReuse(t *testing.T) {
+	a, err := alloc.NewPool(18, 4)
+	if err != nil {
+		t.Fatalf("NewPool: %v", err)
+	}
+	if a.FreeSpace() != 16 {
+		t.Errorf("free space = %d, want 16", a.FreeSpace())
+	}
+
+	offsets := make([]int, 0, 4)
+	for i := 0; i < 4; i++ {
+		off, err := a.Alloc(2)
+		if err != nil {
+			t.Fatalf("alloc %d: %v", i, err)
+		}
+		offsets = append(offsets, off)
+	}
+	if offsets[3] != 12 {
+		t.Errorf("fourth offset = %d, want 12", offsets[3])
+	}
+	if _, err := a.Alloc(4); err == nil {
+		t.Fatal("expected OOM error, got nil")
+	}
+
+	if err := a.Free(offsets[1], 2); err != nil {
+		t.Fatalf("free: %v", err)
+	}
+	off, err := a.Alloc(4)
+	if err != nil {
+		t.Fatalf("realloc: %v", err)
+	}
+	if off != offsets[1] {
+		t.Errorf("reused offset = %d, want %d", off, offsets[1])
+	}
+}
+
+func TestPoolRejectsInvalidRequests(t *testing.T) {
+	if _, err := alloc.NewPool(16, 0); err == nil {
+		t.Error("NewPool with slot size 0 succeeded")
+	}
+
+	a, _ := alloc.NewPool(16, 4)
+	if _, err := a.Alloc(8); err == nil {
+		t.Error("alloc larger than a slot succeeded")
+	}
+
+	off, _ := a.Alloc(4)
+	if err := a.Free(off+2, 2); err == nil {
+		t.Error("free at unaligned offset succeeded")
+	}
+	if err := a.Free(off, 4); err != nil {
+		t.Fatalf("free: %v", err)
+	}
+	if err := a.Free(off, 4); err == nil {
+		t.Error("double free succeeded")
+	}
+}
+
+func TestPoolGrowAddsSlots(t *testing.T) {
+	a, _ := alloc.NewPool(8, 4)
+	off1, _ := a.Alloc(4)
+	_, _ = a.Alloc(4)
+	if err := a.Free(off1, 4); err != nil {
+		t.Fatalf("free: %v", err)
+	}
+
+	if err := a.Grow(16); err != nil {
+		t.Fatalf("grow: %v", err)
+	}
+	if a.FreeSpace() != 12 {
+		t.Errorf("free space = %d, want 12", a.FreeSpace())
+	}
+	for _, want := range []int{0, 8, 12} {
+		off, err := a.Alloc(4)
+		if err != nil {
+			t.Fatalf("alloc: %v", err)
+		}
+		if off != want {
+			t.Errorf("offset = %d, want %d", off, want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/mwantia/vega/pkg/parser"
+	"github.com/mwantia/vega/pkg/value"
+)
+
+// compileDeclaration compiles 'name: type' without an initial value. Scalar
+// declarations reserve an uninitialized slot; 'name: type[N]' reserves a
+// fixed-size array of N elements stored inline in the alloc buffer.
+func (c *Compiler) compileDeclaration(b *ByteCode, s *parser.DeclarationStatement) error {
+	if c.scope == nil {
+		return fmt.Errorf("declaration outside alloc block")
+	}
+
+	name := s.Name.Value
+	if _, exists := c.scope.Lookup(name); exists {
+		return fmt.Errorf("variable '%s' is already defined", name)
+	}
+
+	for _, constraint := range s.Constraints {
+		if array, ok := constraint.(*parser.IndexExpression); ok {
+			if len(s.Constraints) > 1 {
+				return fmt.Errorf("array type for '%s' cannot be part of a union", name)
+			}
+			return c.compileArrayDeclaration(b, name, array, s.Position().Line)
+		}
+	}
+
+	tag, mask, err := c.resolveConstraints(s.Constraints)
+	if err != nil {
+		return fmt.Errorf("type constraint for '%s': %v", name, err)
+	}
+	info := c.scope.Define(name, tag, mask)
+	if tag == value.TagString {
+		// Marked as a declaration, which starts empty in a persistent arena
+		b.Symbol(b.EmitArgExtra(OpStrALLOC, info.SlotID, 1, s.Position().Line), name)
+		return nil
+	}
+	emitSlotAlloc(b, info, s.Position().Line)
+	return nil
+}
+
+func (c *Compiler) compileArrayDeclaration(b *ByteCode, name string, array *parser.IndexExpression, line int) error {
+	typeName, ok := array.Left.(*parser.IdentifierExpression)
+	if !ok {
+		return fmt.Errorf("array element type must be an identifier, got %T", array.Left)
+	}
+	tag, ok := value.TagForName(typeName.Value)
+	if !ok {
+		return fmt.Errorf("unknown type name '%s'", typeName.Value)
+	}
+	if value.SizeForTag(tag) == 0 {
+		return fmt.Errorf("array elements must have a fixed-size type, got '%s'", typeName.Value)
+	}
+	length, ok := array.Index.(*parser.IntegerExpression)
+	if !ok || length.Value <= 0 {
+		return fmt.Errorf("array length must be a positive integer literal, got '%s'", array.Index.String())
+	}
+
+	info := c.scope.Define(name, tag, value.MaskForTag(tag))
+	info.Array = true
+	info.Length = int(length.Value)
+	c.scope.Update(name, info)
+
+	// Emit array alloc: Argument=slotID, Offset=element count, Extra=element tag
+	b.Symbol(b.EmitField(OpArrayALLOC, info.SlotID, info.Length, byte(tag), line), name)
+	return nil
+}
+
+// lookupArray resolves the target of an index expression to an array symbol.
+func (c *Compiler) lookupArray(expr parser.Expression) (SymbolInfo, error) {
+	ident, ok := expr.(*parser.IdentifierExpression)
+	if !ok {
+		return SymbolInfo{}, fmt.Errorf("indexing requires an identifier, got %T", expr)
+	}
+	if c.scope == nil {
+		return SymbolInfo{}, fmt.Errorf("identifier '%s' outside alloc block", ident.Value)
+	}
+	info, exists := c.scope.Lookup(ident.Value)
+	if !exists {
+		return SymbolInfo{}, fmt.Errorf("undefined variable '%s'", ident.Value)
+	}
+	if !info.Array {
+		return SymbolInfo{}, fmt.Errorf("variable '%s' is not an array", ident.Value)
+	}
+	return info, nil
+}
+
+// compileIndex compiles the index of an element access. The index must be an
+// integer; the bounds are checked at runtime by OpArrayLOAD/OpArraySTORE.
+func (c *Compiler) compileIndex(b *ByteCode, index parser.Expression) error {
+	tag, err := c.inferTypeTag(index)
+	if err != nil {
+		return fmt.Errorf("array index: %v", err)
+	}
+	if !isIndexTag(tag) {
+		name, _ := value.NameForTag(tag)
+		return fmt.Errorf("array index must be an integer, got %s", name)
+	}
+	return c.compileExpression(b, index)
+}
+
+func (c *Compiler) compileIndexAssignment(b *ByteCode, s *parser.IndexAssignmentStatement) error {
+	if c.scope == nil {
+		return fmt.Errorf("assignment outside alloc block")
+	}
+	if tag, err := c.inferTypeTag(s.Left.Left); err == nil && tag == value.TagString {
+		return fmt.Errorf("strings are immutable; assign a new string to '%s' instead", s.Left.Left.String())
+	}
+	info, err := c.lookupArray(s.Left.Left)
+	if err != nil {
+		return err
+	}
+
+	rhs, err := coerceLiteral(s.Value, value.MaskForTag(info.Tag))
+	if err != nil {
+		return fmt.Errorf("element of '%s': %v", s.Left.Left.String(), err)
+	}
+	tag, err := c.inferTypeTag(rhs)
+	if err != nil {
+		return fmt.Errorf("cannot infer type for element of '%s': %v", s.Left.Left.String(), err)
+	}
+	if tag != info.Tag {
+		want, _ := value.NameForTag(info.Tag)
+		got, _ := value.NameForTag(tag)
+		return fmt.Errorf("type mismatch: array '%s' holds %s, got %s", s.Left.Left.String(), want, got)
+	}
+
+	if err := c.compileIndex(b, s.Left.Index); err != nil {
+		return err
+	}
+	if err := c.compileExpression(b, rhs); err != nil {
+		return fmt.Errorf("failed to compile element value: %v", err)
+	}
+	b.EmitArgExtra(OpArraySTORE, info.SlotID, byte(info.Tag), s.Position().Line)
+	return nil
+}
+
+// isIndexTag reports whether values of the tag can index an array.
+func isIndexTag(tag value.TypeTag) bool {
+	switch tag {
+	case value.TagByte, value.TagShort, value.TagInteger, value.TagLong:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,424 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/mwantia/vega/pkg/alloc"
+	"github.com/mwantia/vega/pkg/value"
+)
+
+// autoSizer computes the capacity of an 'alloc auto' block by replaying the
+// allocations of its body against a layout of the block's strategy and
+// recording the highest byte it hands out. The body is walked once in
+// instruction order, so both branches of an if are counted and a loop body
+// counts as one pass; block locals are freed at the end of every pass, so
+// repeating it needs no more memory. The frees of a break or continue are
+// skipped, since the rest of the body runs with the locals still live.
+// Because the layout hands out the offsets of the real allocator, the
+// figure includes the fragmentation that first-fit, the bump pointer or the
+// pool slots cause for this order of allocations.
+type autoSizer struct {
+	c          *Compiler
+	memory     *layout
+	peak       int
+	calls      []string // functions being walked, to reject recursion
+	persistent bool     // declared strings start empty and take a length prefix
+
+	// Set by the lifetime analysis to learn which slots an alias views
+	views   map[int][]int        // slots whose bytes each alias load or store reaches, by address
+	owners  []owner              // last block slot to hold each byte, sorted by offset
+	aliases map[int]alloc.Region // region of each alias slot with a constant offset
+}
+
+// owner is a run of bytes last held by the block slot id.
+type owner struct {
+	alloc.Region
+	id int
+}
+
+// overLimit is the error of an allocation that takes the layout beyond the
+// limit of the compiler.
+type overLimit struct {
+	line, need, limit int
+}
+
+func (e *overLimit) Error() string {
+	return fmt.Sprintf("the allocation at line %d needs %d bytes, more than the limit of %d bytes", e.line, e.need, e.limit)
+}
+
+// autoSize returns the capacity needed by the body of an alloc block, the
+// instructions of b from start up to the block's OpStackFREE.
+func (c *Compiler) autoSize(b *ByteCode, start int, strategy alloc.Strategy, slotSize int) (int, error) {
+	sizer, err := c.newAutoSizer(strategy, slotSize)
+	if err != nil {
+		return 0, err
+	}
+	sizer.persistent = b.Instructions[start-1].Persistent != nil
+	if err := sizer.walk(b, start, false); err != nil {
+		return 0, fmt.Errorf("alloc auto: %v", err)
+	}
+	return sizer.peak, nil
+}
+
+func (c *Compiler) newAutoSizer(strategy alloc.Strategy, slotSize int) (*autoSizer, error) {
+	switch strategy {
+	case alloc.StrategyFreeList, alloc.StrategyBump:
+		slotSize = 0
+	case alloc.StrategyPool:
+		if slotSize <= 0 {
+			return nil, fmt.Errorf("pool slot size must be positive, got %d", slotSize)
+		}
+	default:
+		return nil, fmt.Errorf("unknown allocator strategy %d", byte(strategy))
+	}
+	return &autoSizer{c: c, memory: &layout{strategy: strategy, slotSize: slotSize}}, nil
+}
+
+// aliasViews replays the body of the alloc block whose STACK_ALLOC is at
+// addr and returns the slots that each alias load or store in it reaches.
+// Blocks without aliases of their own are not replayed. The replay stops
+// where the layout can no longer be followed, such as a string of unknown
+// length, so later accesses are left out; it only returns the error of a
+// layout beyond the limit of the compiler.
+func (c *Compiler) aliasViews(b *ByteCode, addr int) (map[int][]int, error) {
+	if !hasAliases(b, addr+1) {
+		return nil, nil
+	}
+	instr := b.Instructions[addr]
+	sizer, err := c.newAutoSizer(alloc.Strategy(instr.Extra), instr.Offset)
+	if err != nil {
+		return nil, nil
+	}
+	sizer.persistent = instr.Persistent != nil
+	sizer.views = make(map[int][]int)
+	sizer.aliases = make(map[int]alloc.Region)
+	if err := sizer.walk(b, addr+1, false); errors.As(err, new(*overLimit)) {
+		return sizer.views, err
+	}
+	return sizer.views, nil
+}
+
+// hasAliases reports whether the alloc block whose body starts at start
+// binds a pointer alias outside its nested blocks.
+func hasAliases(b *ByteCode, start int) bool {
+	depth := 0
+	for _, instr := range b.Instructions[start:] {
+		switch instr.Operation {
+		case OpStackALLOC:
+			depth++
+		case OpStackFREE:
+			if depth == 0 {
+				return false
+			}
+			depth--
+		case OpVarPTR:
+			if depth == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// walk replays the instructions of b from start until the end of the alloc
+// block, or the end of a function body when frame is set. Nested alloc
+// blocks have arenas of their own and are skipped. A frame's slots are
+// released when it ends.
+func (s *autoSizer) walk(b *ByteCode, start int, frame bool) error {
+	slots := make(map[int]alloc.Region)
+	strings := make(map[int]int) // byte length of the string in a slot
+	pushed := -1                 // length of the string pushed last, -1 if unknown
+	depth := 0
+
+	for i, instr := range b.Instructions[start:] {
+		addr := start + i
+		if depth > 0 || instr.Operation == OpStackALLOC {
+			switch instr.Operation {
+			case OpStackALLOC:
+				depth++
+			case OpStackFREE:
+				depth--
+			}
+			continue
+		}
+		if instr.Operation == OpStackFREE {
+			break
+		}
+
+		size := -1
+		switch instr.Operation {
+		case OpVarALLOC:
+			size = value.MaxSizeForMask(instr.Extra)
+		case OpStencilALLOC:
+			size = instr.Offset
+		case OpArrayALLOC:
+			size = instr.Offset * value.SizeForTag(value.TypeTag(instr.Extra))
+		case OpStrALLOC:
+			// Strings own no memory until their first store; the value
+			// to store is already pushed
+			slots[instr.Argument] = alloc.Region{}
+			strings[instr.Argument] = 0
+			if instr.Extra == 1 && s.persistent {
+				offset, err := s.alloc(value.StringPrefixSize, instr.SourceLine)
+				if err != nil {
+					return err
+				}
+				slots[instr.Argument] = alloc.Region{Offset: offset, Size: value.StringPrefixSize}
+				s.own(slots[instr.Argument], instr.Argument, frame)
+			}
+			continue
+		case OpStrSTORE:
+			region, ok := slots[instr.Argument]
+			if !ok {
+				break // a string of an enclosing block, stored in its arena
+			}
+			if pushed < 0 {
+				return fmt.Errorf("cannot size the string stored at line %d; its length is only known at runtime", instr.SourceLine)
+			}
+			strings[instr.Argument] = pushed
+			if need := value.StringPrefixSize + pushed; region.Size < need {
+				// The new region is taken before the outgrown one is released
+				offset, err := s.alloc(need, instr.SourceLine)
+				if err != nil {
+					return err
+				}
+				s.release(region)
+				slots[instr.Argument] = alloc.Region{Offset: offset, Size: need}
+				s.own(slots[instr.Argument], instr.Argument, frame)
+			}
+		case OpVarFREE:
+			if instr.Extra&FreeEarly != 0 {
+				break // a break or continue; the code after its jump still uses the slot
+			}
+			if region, ok := slots[instr.Argument]; ok {
+				s.release(region)
+				delete(slots, instr.Argument)
+			}
+		case OpCallFN:
+			if err := s.call(instr.Argument, instr.SourceLine); err != nil {
+				return err
+			}
+		case OpVarPTR, OpVarLOAD, OpVarSTORE, OpArenaCOMPACT:
+			if s.views != nil && !frame {
+				s.alias(b, addr, instr)
+			}
+		}
+		if size >= 0 {
+			offset, err := s.alloc(size, instr.SourceLine)
+			if err != nil {
+				return err
+			}
+			slots[instr.Argument] = alloc.Region{Offset: offset, Size: size}
+			s.own(slots[instr.Argument], instr.Argument, frame)
+		}
+
+		pushed = -1
+		switch instr.Operation {
+		case OpLoadCONST:
+			if constant := b.Constants[instr.Argument]; constant.Tag == value.TagString {
+				pushed = len(constant.Data)
+			}
+		case OpStrLOAD:
+			if length, ok := strings[instr.Argument]; ok {
+				pushed = length
+			}
+		}
+	}
+
+	if frame {
+		// Released highest slot first, like FN_RETURN
+		ids := make([]int, 0, len(slots))
+		for id := range slots {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+		for _, id := range slices.Backward(ids) {
+			s.release(slots[id])
+		}
+	}
+	return nil
+}
+
+// call replays the body of the function at index in a frame of its own.
+func (s *autoSizer) call(index, line int) error {
+	fn := s.c.functions[index]
+	if slices.Contains(s.calls, fn.Name) {
+		return fmt.Errorf("cannot size the recursive call to '%s' at line %d", fn.Name, line)
+	}
+	s.calls = append(s.calls, fn.Name)
+	defer func() {
+		s.calls = s.calls[:len(s.calls)-1]
+	}()
+	return s.walk(fn.ByteCode, 0, true)
+}
+
+// alias records the regions of pointer aliases and the slots their loads
+// and stores reach. Only aliases at a constant offset are followed, and a
+// compaction forgets the layout, since it moves the slots the aliases view.
+func (s *autoSizer) alias(b *ByteCode, addr int, instr Instruction) {
+	switch instr.Operation {
+	case OpVarPTR:
+		delete(s.aliases, instr.Argument)
+		if addr == 0 || b.Instructions[addr-1].Operation != OpLoadCONST {
+			return
+		}
+		constant := b.Constants[b.Instructions[addr-1].Argument]
+		view, err := value.Wrap(constant.Tag, constant.Data)
+		if err != nil {
+			return
+		}
+		offset, err := value.ToInt(view)
+		if err != nil || offset < 0 {
+			return
+		}
+		s.aliases[instr.Argument] = alloc.Region{Offset: offset, Size: value.SizeForTag(value.TypeTag(instr.Extra))}
+	case OpVarLOAD, OpVarSTORE:
+		region, ok := s.aliases[instr.Argument]
+		if !ok {
+			return
+		}
+		var viewed []int
+		for _, o := range s.owners {
+			if o.Offset < region.Offset+region.Size && region.Offset < o.Offset+o.Size && !slices.Contains(viewed, o.id) {
+				viewed = append(viewed, o.id)
+			}
+		}
+		s.views[addr] = viewed
+	case OpArenaCOMPACT:
+		s.owners = nil
+		clear(s.aliases)
+	}
+}
+
+// own records slot id as the last holder of the bytes of region, cutting
+// them out of the runs of earlier holders. Slots of function frames are
+// numbered per frame, so their bytes get no owner.
+func (s *autoSizer) own(region alloc.Region, id int, frame bool) {
+	if s.views == nil || region.Size == 0 {
+		return
+	}
+	start, end := region.Offset, region.Offset+region.Size
+	owners := make([]owner, 0, len(s.owners)+2)
+	for _, o := range s.owners {
+		if o.Offset+o.Size <= start || o.Offset >= end {
+			owners = append(owners, o)
+			continue
+		}
+		if o.Offset < start {
+			owners = append(owners, owner{alloc.Region{Offset: o.Offset, Size: start - o.Offset}, o.id})
+		}
+		if o.Offset+o.Size > end {
+			owners = append(owners, owner{alloc.Region{Offset: end, Size: o.Offset + o.Size - end}, o.id})
+		}
+	}
+	if !frame {
+		owners = append(owners, owner{region, id})
+	}
+	slices.SortFunc(owners, func(a, b owner) int {
+		return a.Offset - b.Offset
+	})
+	s.owners = owners
+}
+
+// alloc takes size bytes from the layout and raises the peak to the end of
+// the region. A peak beyond the limit of the compiler fails, since the VM
+// could not allocate the block either.
+func (s *autoSizer) alloc(size, line int) (int, error) {
+	slotSize := s.memory.slotSize
+	if slotSize > 0 && size > slotSize {
+		return 0, fmt.Errorf("pool slot size is %d bytes, need %d at line %d", slotSize, size, line)
+	}
+	offset := s.memory.alloc(size)
+	end := offset + size
+	if slotSize > 0 && size > 0 {
+		end = offset + slotSize
+	}
+	if limit := s.c.maxAlloc; limit > 0 && end > limit {
+		return 0, &overLimit{line: line, need: end, limit: limit}
+	}
+	s.peak = max(s.peak, end)
+	return offset, nil
+}
+
+// release frees a region the way the runtime does, keeping it allocated
+// when the strategy cannot free it.
+func (s *autoSizer) release(region alloc.Region) {
+	if region.Size > 0 {
+		s.memory.free(region.Offset, region.Size)
+	}
+}
+
+// layout hands out the offsets of an allocator of the given strategy that
+// grows whenever it runs out, without a buffer behind them. Growing appends
+// to the free block at the end of a free list and adds pool slots after the
+// free ones, so the layout treats everything from end on as one unbounded
+// free block.
+type layout struct {
+	strategy alloc.Strategy
+	slotSize int               // of a pool, 0 otherwise
+	blocks   []alloc.FreeBlock // free blocks of a free list below end, sorted by offset
+	slots    []int             // offsets of free pool slots, the next one last
+	end      int               // first byte never handed out, or freed back into the tail
+}
+
+// alloc returns the offset of the next region of size bytes.
+func (l *layout) alloc(size int) int {
+	switch l.strategy {
+	case alloc.StrategyFreeList:
+		for i, block := range l.blocks {
+			if block.Size >= size {
+				if block.Size == size {
+					l.blocks = slices.Delete(l.blocks, i, i+1)
+				} else {
+					l.blocks[i] = alloc.FreeBlock{Offset: block.Offset + size, Size: block.Size - size}
+				}
+				return block.Offset
+			}
+		}
+	case alloc.StrategyPool:
+		if size == 0 {
+			return 0
+		}
+		if n := len(l.slots); n > 0 {
+			offset := l.slots[n-1]
+			l.slots = l.slots[:n-1]
+			return offset
+		}
+		size = l.slotSize
+	}
+	offset := l.end
+	l.end += size
+	return offset
+}
+
+// free releases the region at offset. A bump layout only releases its most
+// recent region, like the allocator.
+func (l *layout) free(offset, size int) {
+	switch l.strategy {
+	case alloc.StrategyFreeList:
+		i, _ := slices.BinarySearchFunc(l.blocks, offset, func(block alloc.FreeBlock, offset int) int {
+			return block.Offset - offset
+		})
+		l.blocks = slices.Insert(l.blocks, i, alloc.FreeBlock{Offset: offset, Size: size})
+		if i+1 < len(l.blocks) && offset+size == l.blocks[i+1].Offset {
+			l.blocks[i].Size += l.blocks[i+1].Size
+			l.blocks = slices.Delete(l.blocks, i+1, i+2)
+		}
+		if i > 0 && l.blocks[i-1].Offset+l.blocks[i-1].Size == offset {
+			l.blocks[i-1].Size += l.blocks[i].Size
+			l.blocks = slices.Delete(l.blocks, i, i+1)
+		}
+		if n := len(l.blocks); n > 0 && l.blocks[n-1].Offset+l.blocks[n-1].Size == l.end {
+			l.end = l.blocks[n-1].Offset
+			l.blocks = l.blocks[:n-1]
+		}
+	case alloc.StrategyBump:
+		if offset+size == l.end {
+			l.end = offset
+		}
+	case alloc.StrategyPool:
+		l.slots = append(l.slots, offset)
+	}
+}
@@ -19,6 +19,9 @@ type ByteCode struct {
 	Instructions []Instruction
 	Constants    []Constant
 	LoopStack    []LoopStack
+	Functions    []*Function    // user-defined functions, indexed by OpCallFN
+	Symbols      map[int]string // debug symbols: variable name by address of its allocating instruction
+	Diagnostics  []Diagnostic   // warnings of the lifetime analysis, see checkLifetimes
 }
 
 type LoopStack struct {
@@ -32,6 +35,10 @@ func (b *ByteCode) Disassemble() string {
 	if len(b.Constants) > 0 {
 		sb.WriteString("=== Constants ===\n")
 		for i, c := range b.Constants {
+			if c.Tag == value.TagString {
+				fmt.Fprintf(&sb, "%4d: %q (string)\n", i, c.Data)
+				continue
+			}
 			if name, ok := value.NameForTag(c.Tag); ok {
 				hex := hex.EncodeToString(c.Data)
 				fmt.Fprintf(&sb, "%4d: %s (%s)\n", i, hex, name)
@@ -46,6 +53,11 @@ func (b *ByteCode) Disassemble() string {
 		}
 	}
 
+	for _, fn := range b.Functions {
+		fmt.Fprintf(&sb, "\n=== Function %s ===\n", fn.Name)
+		sb.WriteString(fn.ByteCode.Disassemble())
+	}
+
 	return sb.String()
 }
 
@@ -124,6 +136,14 @@ func (b *ByteCode) AddConstant(c Constant) int {
 	return idx
 }
 
+// Symbol records name as the variable allocated by the instruction at addr.
+func (b *ByteCode) Symbol(addr int, name string) {
+	if b.Symbols == nil {
+		b.Symbols = make(map[int]string)
+	}
+	b.Symbols[addr] = name
+}
+
 func (b *ByteCode) CurrentAddr() int {
 	return len(b.Instructions)
 }
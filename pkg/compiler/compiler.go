@@ -4,21 +4,37 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"slices"
+	"strings"
 
+	"github.com/mwantia/vega/pkg/alloc"
 	"github.com/mwantia/vega/pkg/parser"
 	"github.com/mwantia/vega/pkg/value"
 )
 
 type SymbolInfo struct {
+	Name    string
 	SlotID  int
 	Tag     value.TypeTag
 	Mask    byte
 	Stencil *Stencil // non-nil for struct/tuple variables
+	Alias   bool     // true for pointer aliases, which own no memory
+	Array   bool     // true for fixed-size arrays; Tag is the element tag
+	Length  int      // element count for arrays
 }
 
 type SymbolTable struct {
 	symbols  map[string]SymbolInfo
 	nextSlot int
+	blocks   [][]blockSymbol // symbols defined per open block, innermost last
+	parent   *SymbolTable    // scope of the enclosing alloc block, nil for the outermost
+	strategy alloc.Strategy  // allocator of the alloc block this scope belongs to
+}
+
+// blockSymbol records a definition made inside a block.
+type blockSymbol struct {
+	name   string
+	slotID int
 }
 
 func newSymbolTable() *SymbolTable {
@@ -28,54 +44,239 @@ func newSymbolTable() *SymbolTable {
 	}
 }
 
+// newArenaTable creates the scope of an alloc block nested in parent. Its
+// slot IDs continue after the parent's, and names not defined in it resolve
+// to the enclosing blocks.
+func newArenaTable(parent *SymbolTable, strategy alloc.Strategy) *SymbolTable {
+	st := newSymbolTable()
+	st.parent = parent
+	st.strategy = strategy
+	if parent != nil {
+		st.nextSlot = parent.nextSlot
+	}
+	return st
+}
+
 func (st *SymbolTable) Lookup(name string) (SymbolInfo, bool) {
-	info, ok := st.symbols[name]
-	return info, ok
+	owner := st.owner(name)
+	if owner == nil {
+		return SymbolInfo{}, false
+	}
+	return owner.symbols[name], true
+}
+
+// owner returns the innermost table that defines name, or nil.
+func (st *SymbolTable) owner(name string) *SymbolTable {
+	for t := st; t != nil; t = t.parent {
+		if _, ok := t.symbols[name]; ok {
+			return t
+		}
+	}
+	return nil
 }
 
 func (st *SymbolTable) Define(name string, tag value.TypeTag, mask byte) SymbolInfo {
 	info := SymbolInfo{
+		Name:   name,
 		SlotID: st.nextSlot,
 		Tag:    tag,
 		Mask:   mask,
 	}
 	st.symbols[name] = info
 	st.nextSlot++
+	if n := len(st.blocks); n > 0 {
+		st.blocks[n-1] = append(st.blocks[n-1], blockSymbol{name: name, slotID: info.SlotID})
+	}
 	return info
 }
 
+// Update replaces the symbol info of an already defined name.
+func (st *SymbolTable) Update(name string, info SymbolInfo) {
+	if owner := st.owner(name); owner != nil {
+		owner.symbols[name] = info
+		return
+	}
+	st.symbols[name] = info
+}
+
 func (st *SymbolTable) Remove(name string) {
-	delete(st.symbols, name)
+	if owner := st.owner(name); owner != nil {
+		delete(owner.symbols, name)
+	}
+}
+
+// FreedOnAllPaths reports whether a free of name at this point runs
+// whenever the block that defines name does, that is, no branch or loop
+// was entered since its definition.
+func (st *SymbolTable) FreedOnAllPaths(name string) bool {
+	for t := st; t != nil; t = t.parent {
+		info, ok := t.symbols[name]
+		if !ok {
+			if t.Depth() > 0 {
+				return false
+			}
+			continue
+		}
+		defined := 0
+		for i := len(t.blocks) - 1; i >= 0 && defined == 0; i-- {
+			if slices.Contains(t.blocks[i], blockSymbol{name: name, slotID: info.SlotID}) {
+				defined = i + 1
+			}
+		}
+		return defined == t.Depth()
+	}
+	return false
+}
+
+// EnterBlock opens a nested block. Names first defined inside the block are
+// local to it and go out of scope at the matching ExitBlock.
+func (st *SymbolTable) EnterBlock() {
+	st.blocks = append(st.blocks, nil)
+}
+
+// Depth returns the number of open blocks.
+func (st *SymbolTable) Depth() int {
+	return len(st.blocks)
+}
+
+// LocalsSince returns the symbols still defined in all blocks opened at or
+// after depth, innermost first and in reverse definition order. The blocks
+// stay open; this is used to release locals when jumping out of them.
+func (st *SymbolTable) LocalsSince(depth int) []SymbolInfo {
+	locals := make([]SymbolInfo, 0)
+	for i := len(st.blocks) - 1; i >= depth && i >= 0; i-- {
+		defined := st.blocks[i]
+		for j := len(defined) - 1; j >= 0; j-- {
+			info, ok := st.symbols[defined[j].name]
+			if !ok || info.SlotID != defined[j].slotID {
+				continue
+			}
+			locals = append(locals, info)
+		}
+	}
+	return locals
+}
+
+// ExitBlock closes the innermost block, removes its locals from the table
+// and returns the ones still defined in reverse definition order.
+func (st *SymbolTable) ExitBlock() []SymbolInfo {
+	n := len(st.blocks)
+	if n == 0 {
+		return nil
+	}
+	defined := st.blocks[n-1]
+	st.blocks = st.blocks[:n-1]
+
+	locals := make([]SymbolInfo, 0, len(defined))
+	for i := len(defined) - 1; i >= 0; i-- {
+		info, ok := st.symbols[defined[i].name]
+		// Skip names already freed, or freed and redefined by another slot
+		if !ok || info.SlotID != defined[i].slotID {
+			continue
+		}
+		delete(st.symbols, defined[i].name)
+		locals = append(locals, info)
+	}
+	return locals
+}
+
+// arithmeticOperations maps binary arithmetic operators to their opcodes.
+var arithmeticOperations = map[string]OperationCode{
+	"+": OpArithADD,
+	"-": OpArithSUB,
+	"*": OpArithMUL,
+	"/": OpArithDIV,
+	"%": OpArithMOD,
+}
+
+// comparisonOperations maps comparison operators to their opcodes.
+// Every comparison produces a boolean.
+var comparisonOperations = map[string]OperationCode{
+	"==": OpCmpEQ,
+	"!=": OpCmpNE,
+	"<":  OpCmpLT,
+	"<=": OpCmpLE,
+	">":  OpCmpGT,
+	">=": OpCmpGE,
 }
 
 type Compiler struct {
-	scope    *SymbolTable // nil outside alloc blocks
-	stencils map[string]*Stencil
+	scope      *SymbolTable // nil outside alloc blocks and functions
+	stencils   map[string]*Stencil
+	functions  []*Function
+	function   *Function // function currently being compiled, nil at top level
+	loopBlocks []int     // block depth of each enclosing loop body, innermost last
+	fence      string    // the block that hides the enclosing loops from break and continue
+	atomics    int       // number of enclosing atomic blocks
+	strict     bool      // lossy conversions, leaks and definite lifetime problems fail instead of warning
+	maxAlloc   int       // largest arena the static passes lay out, 0 for no limit
 }
 
+// DefaultMaxAllocSize is the default limit for the arenas that the compiler
+// lays out to size 'alloc auto' and to check aliases. The VM uses the same
+// default for the combined capacity of all live alloc blocks.
+const DefaultMaxAllocSize = 64 << 20
+
 func NewCompiler() *Compiler {
 	return &Compiler{
 		stencils: make(map[string]*Stencil),
+		maxAlloc: DefaultMaxAllocSize,
 	}
 }
 
+// SetMaxAllocSize sets the limit in bytes for the arenas the compiler lays
+// out, like the VM's MaxAllocSize. An 'alloc auto' body that needs more
+// fails to compile. Values <= 0 remove the limit.
+func (c *Compiler) SetMaxAllocSize(size int) {
+	c.maxAlloc = max(size, 0)
+}
+
+// SetStrict enables strict mode. Conversion intrinsics such as byte() or int()
+// compiled afterwards fail at runtime when the value does not fit exactly,
+// instead of wrapping, truncating or rounding it. Leaks found when an alloc
+// block exits fail at runtime, and lifetime problems found on every path
+// fail the compilation; those found on some paths only stay warnings.
+func (c *Compiler) SetStrict(strict bool) {
+	c.strict = strict
+}
+
 func (c *Compiler) Compile(ast parser.AST) (*ByteCode, error) {
+	// Discard scope state left behind by a previously failed compilation
+	c.scope, c.function, c.loopBlocks, c.atomics = nil, nil, nil, 0
+
 	byteCode := &ByteCode{
 		Instructions: make([]Instruction, 0),
 		Constants:    make([]Constant, 0),
 		LoopStack:    nil,
+		Functions:    c.functions,
 	}
 
 	statements := ast.Statements()
 	if len(statements) == 0 {
 		return nil, fmt.Errorf("invalid program defined: expected statements")
 	}
+	declared := len(c.functions)
 
 	for _, stmt := range statements {
 		if err := c.compileStatement(byteCode, stmt); err != nil {
 			return nil, fmt.Errorf("failed to compile statement '%s': %v", stmt.String(), err)
 		}
 	}
+	// Functions declared by this program were appended while compiling
+	byteCode.Functions = c.functions
+
+	byteCode.Diagnostics = c.checkLifetimes(byteCode, c.functions[declared:])
+	if c.strict {
+		var messages []string
+		for _, d := range byteCode.Diagnostics {
+			if d.Definite {
+				messages = append(messages, d.String())
+			}
+		}
+		if len(messages) > 0 {
+			return nil, fmt.Errorf("lifetime check failed: %s", strings.Join(messages, "; "))
+		}
+	}
 
 	return byteCode, nil
 }
@@ -83,31 +284,87 @@ func (c *Compiler) Compile(ast parser.AST) (*ByteCode, error) {
 func (c *Compiler) compileStatement(b *ByteCode, statement parser.Statement) error {
 	switch s := statement.(type) {
 	case *parser.AllocStatement:
-		intExpr, ok := s.Size.(*parser.IntegerExpression)
-		if !ok {
-			return fmt.Errorf("alloc size must be an integer literal, got %T", s.Size)
+		if c.function != nil {
+			return fmt.Errorf("alloc blocks are not allowed inside functions; functions use the caller's arena")
 		}
-		b.EmitArg(OpStackALLOC, int(intExpr.Value), s.Position().Line)
+		strategy, slotSize, err := allocStrategy(s)
+		if err != nil {
+			return err
+		}
+		if s.From != nil && s.From.Value == "" {
+			return fmt.Errorf("persistent arena path must not be empty")
+		}
+		// The size and growth ceiling are evaluated at runtime in the
+		// enclosing scope, so they may use natives and the variables of
+		// outer alloc blocks. The size of 'alloc auto' is only known once
+		// the body is compiled, so its constant is patched in afterwards.
+		sizeAddr := -1
+		if s.Auto {
+			sizeAddr = b.EmitArg(OpLoadCONST, 0, s.Position().Line)
+		} else if err := c.compileAllocSize(b, "alloc size", s.Size); err != nil {
+			return err
+		}
+		growable := 0
+		if s.Grow != nil {
+			if err := c.compileAllocSize(b, "grow ceiling", s.Grow); err != nil {
+				return err
+			}
+			growable = 1
+		}
+		allocAddr := b.EmitField(OpStackALLOC, growable, slotSize, byte(strategy), s.Position().Line)
 
-		// Enter alloc scope
-		c.scope = newSymbolTable()
+		// Enter alloc scope; a nested block sees the variables of the
+		// enclosing ones, but loops cannot be left from inside it
+		outerScope, outerLoops, outerFence := c.scope, c.loopBlocks, c.fence
+		c.scope, c.loopBlocks, c.fence = newArenaTable(outerScope, strategy), nil, "an alloc block"
+		base := c.scope.nextSlot
 
 		for _, stmt := range s.Body.Statements {
 			if err := c.compileStatement(b, stmt); err != nil {
+				c.scope, c.loopBlocks, c.fence = outerScope, outerLoops, outerFence
 				return fmt.Errorf("failed to compile alloc body: %v", err)
 			}
 		}
 
+		// The file of a persistent arena is only valid for the layout of
+		// the variables left at the end of the body
+		if s.From != nil {
+			b.Instructions[allocAddr].Persistent = &PersistentArena{
+				Path:        s.From.Value,
+				Base:        base,
+				Fingerprint: layoutFingerprint(c.scope, base, strategy, slotSize),
+			}
+		}
+
 		// Exit alloc scope
-		c.scope = nil
+		c.scope, c.loopBlocks, c.fence = outerScope, outerLoops, outerFence
+
+		// Leaks found by the VM's leak check are errors in strict mode
+		strict := 0
+		if c.strict {
+			strict = 1
+		}
+		b.EmitArg(OpStackFREE, strict, s.Position().Line)
 
-		b.Emit(OpStackFREE, s.Position().Line)
+		if s.Auto {
+			size, err := c.autoSize(b, allocAddr+1, strategy, slotSize)
+			if err != nil {
+				return err
+			}
+			data := make([]byte, 4)
+			binary.LittleEndian.PutUint32(data, uint32(size))
+			b.Instructions[sizeAddr].Argument = b.AddConstant(Constant{Tag: value.TagInteger, Data: data})
+			b.Instructions[allocAddr].Auto = size
+		}
 	case *parser.AssignmentStatement:
 		if c.scope == nil {
 			return fmt.Errorf("assignment outside alloc block")
 		}
 
 		name := s.Name.Value
+		if info, exists := c.scope.Lookup(name); exists && info.Array {
+			return fmt.Errorf("cannot assign to array '%s'; assign its elements with '%s[i] = ...'", name, name)
+		}
 
 		// Check if RHS is a struct literal expression
 		if structExpr, ok := s.Value.(*parser.StructExpression); ok {
@@ -119,6 +376,17 @@ func (c *Compiler) compileStatement(b *ByteCode, statement parser.Statement) err
 			return c.compileTupleAssignment(b, s, tupleExpr)
 		}
 
+		// Check if RHS is another struct or tuple variable
+		if src, ok := c.lookupStencilSymbol(s.Value); ok {
+			return c.compileStencilCopy(b, s, src)
+		}
+		if info, exists := c.scope.Lookup(name); exists && info.Stencil != nil {
+			if tag, err := c.inferTypeTag(s.Value); err == nil {
+				got, _ := value.NameForTag(tag)
+				return fmt.Errorf("type mismatch: '%s' holds %s, got %s", name, describeStencil(info.Stencil), value.NameOrUnknown(got))
+			}
+		}
+
 		// Check if RHS is a pointer alias expression
 		if ptrExpr, ok := s.Value.(*parser.PointerExpression); ok {
 			// Compile the offset expression (pushes offset onto expr stack)
@@ -130,19 +398,39 @@ func (c *Compiler) compileStatement(b *ByteCode, statement parser.Statement) err
 			if !ok {
 				return fmt.Errorf("unknown type name '%s' in pointer", ptrExpr.TypeName)
 			}
+			if value.SizeForTag(tag) == 0 {
+				return fmt.Errorf("pointer type must have a fixed size, got '%s'", ptrExpr.TypeName)
+			}
 
 			if _, exists := c.scope.Lookup(name); !exists {
 				mask := value.MaskForTag(tag)
-				c.scope.Define(name, tag, mask)
+				info := c.scope.Define(name, tag, mask)
+				info.Alias = true
+				c.scope.Update(name, info)
 			}
 
 			info, _ := c.scope.Lookup(name)
-			b.EmitArgExtra(OpVarPTR, info.SlotID, byte(tag), s.Position().Line)
+			b.Symbol(b.EmitArgExtra(OpVarPTR, info.SlotID, byte(tag), s.Position().Line), name)
 			return nil
 		}
 
+		// Numeric literals take the narrowest type the slot allows, so
+		// 'count: long = 0' stores a long
+		var target byte
+		if info, exists := c.scope.Lookup(name); exists {
+			target = info.Mask
+		} else if len(s.Constraints) > 0 {
+			if _, m, err := c.resolveConstraints(s.Constraints); err == nil {
+				target = m
+			}
+		}
+		rhs, err := coerceLiteral(s.Value, target)
+		if err != nil {
+			return fmt.Errorf("value for '%s': %v", name, err)
+		}
+
 		// Compile RHS expression (pushes value onto expression stack)
-		if err := c.compileExpression(b, s.Value); err != nil {
+		if err := c.compileExpression(b, rhs); err != nil {
 			return fmt.Errorf("failed to compile assignment value: %v", err)
 		}
 
@@ -152,16 +440,19 @@ func (c *Compiler) compileStatement(b *ByteCode, statement parser.Statement) err
 
 			if len(s.Constraints) > 0 {
 				// Typed assignment — resolve constraint mask
-				var err error
-				mask, err = c.resolveConstraintMask(s.Constraints)
+				tag, m, err := c.resolveConstraints(s.Constraints)
 				if err != nil {
 					return fmt.Errorf("type constraint for '%s': %v", name, err)
 				}
+				mask = m
 				// Infer the initial tag from the RHS for the symbol table
-				inferredTag, _ = c.inferTypeTag(s.Value)
+				inferredTag, _ = c.inferTypeTag(rhs)
+				if tag == value.TagString || inferredTag == value.TagString {
+					inferredTag = tag
+				}
 			} else {
 				// Untyped assignment — infer type and build single-type mask
-				tag, err := c.inferTypeTag(s.Value)
+				tag, err := c.inferTypeTag(rhs)
 				if err != nil {
 					return fmt.Errorf("cannot infer type for '%s': %v", name, err)
 				}
@@ -170,11 +461,23 @@ func (c *Compiler) compileStatement(b *ByteCode, statement parser.Statement) err
 			}
 
 			info := c.scope.Define(name, inferredTag, mask)
-			b.EmitArgExtra(OpVarALLOC, info.SlotID, mask, s.Position().Line)
+			emitSlotAlloc(b, info, s.Position().Line)
 		}
 
 		info, _ := c.scope.Lookup(name)
-		b.EmitArg(OpVarSTORE, info.SlotID, s.Position().Line)
+		if err := c.checkStringAssignment(name, info, rhs); err != nil {
+			return err
+		}
+		emitSlotStore(b, info, s.Position().Line)
+
+	case *parser.DeclarationStatement:
+		return c.compileDeclaration(b, s)
+
+	case *parser.IndexAssignmentStatement:
+		return c.compileIndexAssignment(b, s)
+
+	case *parser.FieldAssignmentStatement:
+		return c.compileFieldAssignment(b, s)
 
 	case *parser.FreeStatement:
 		if c.scope == nil {
@@ -186,44 +489,148 @@ func (c *Compiler) compileStatement(b *ByteCode, statement parser.Statement) err
 		if !exists {
 			return fmt.Errorf("free: undefined variable '%s'", name)
 		}
+		if c.scope.owner(name).strategy == alloc.StrategyBump && c.function == nil {
+			return fmt.Errorf("free: cannot free '%s' in a bump arena; its memory is released when the alloc block ends", name)
+		}
 
 		b.EmitArg(OpVarFREE, info.SlotID, s.Position().Line)
-		c.scope.Remove(name)
+		// A free in a branch or loop leaves the variable live on the other
+		// paths, so it stays defined and the lifetime analysis reports
+		// what uses it afterwards
+		if c.scope.FreedOnAllPaths(name) {
+			c.scope.Remove(name)
+		}
 
 	case *parser.StructStatement:
 		// Build a stencil from the field declarations and register it.
-		// This is pure compile-time data — no bytecode emitted.
-		stencil := &Stencil{
-			Name:   s.Name,
-			Fields: make([]FieldLayout, 0, len(s.Fields)),
-		}
-		offset := 0
+		// This is pure compile-time data — no bytecode emitted. Fields may
+		// reference previously declared structs, which are stored inline.
+		fields := make([]StencilField, 0, len(s.Fields))
 		for _, f := range s.Fields {
 			tag, ok := value.TagForName(f.Type)
+			if nested, exists := c.stencils[f.Type]; !ok && exists {
+				fields = append(fields, Embed(f.Name, nested))
+				continue
+			}
 			if !ok {
 				return fmt.Errorf("struct '%s': unknown type '%s' for field '%s'", s.Name, f.Type, f.Name)
 			}
-			stencil.Fields = append(stencil.Fields, FieldLayout{
-				Name:   f.Name,
-				Offset: offset,
-				Tag:    tag,
-			})
-			offset += value.SizeForTag(tag)
+			if value.SizeForTag(tag) == 0 {
+				return fmt.Errorf("struct '%s': field '%s' must have a fixed-size type, got '%s'", s.Name, f.Name, f.Type)
+			}
+			fields = append(fields, Field(f.Name, tag))
 		}
-		stencil.TotalSize = offset
-		c.stencils[s.Name] = stencil
+		c.stencils[s.Name] = newStencil(s.Name, fields)
 
 	case *parser.CallStatement:
+		if _, in, ok := lookupIntrinsic(s.Function); ok {
+			if err := in.compile(c, b, s.Arguments, s.Position().Line); err != nil {
+				return err
+			}
+			// Discard the unused result
+			b.Emit(OpStackPOP, s.Position().Line)
+			break
+		}
 		ident, ok := s.Function.(*parser.IdentifierExpression)
 		if !ok {
 			return fmt.Errorf("only identifier function calls are supported, got %T", s.Function)
 		}
-		for i, arg := range s.Arguments {
-			if err := c.compileExpression(b, arg); err != nil {
-				return fmt.Errorf("argument %d of call to '%s': %v", i, ident.Value, err)
+		if fn, index, ok := c.LookupFunction(ident.Value); ok {
+			if err := c.compileFunctionCall(b, fn, index, s.Arguments, s.Position().Line); err != nil {
+				return err
+			}
+			// Discard the unused return value
+			if fn.Returns != 0 {
+				b.Emit(OpStackPOP, s.Position().Line)
 			}
+			break
+		}
+		sig, err := c.compileNativeCall(b, ident.Value, s.Arguments, s.Position().Line)
+		if err != nil {
+			return err
+		}
+		// Discard the unused return values
+		for range sig.Returns {
+			b.Emit(OpStackPOP, s.Position().Line)
+		}
+
+	case *parser.IfStatement:
+		if c.scope == nil {
+			return fmt.Errorf("if statement outside alloc block")
+		}
+		if err := c.compileCondition(b, s.Condition); err != nil {
+			return fmt.Errorf("if condition: %v", err)
+		}
+		jumpElse := b.EmitArg(OpJMP_IF_FALSE, 0, s.Position().Line)
+
+		if err := c.compileBlock(b, s.Consequence); err != nil {
+			return err
+		}
+
+		if s.Alternative == nil {
+			b.PatchJump(jumpElse)
+			break
+		}
+
+		jumpEnd := b.EmitArg(OpJMP, 0, s.Position().Line)
+		b.PatchJump(jumpElse)
+		if err := c.compileBlock(b, s.Alternative); err != nil {
+			return err
+		}
+		b.PatchJump(jumpEnd)
+
+	case *parser.WhileStatement:
+		if c.scope == nil {
+			return fmt.Errorf("while statement outside alloc block")
+		}
+		start := b.CurrentAddr()
+		if err := c.compileCondition(b, s.Condition); err != nil {
+			return fmt.Errorf("while condition: %v", err)
 		}
-		b.EmitNameArg(OpCallNAT, ident.Value, len(s.Arguments), s.Position().Line)
+		jumpEnd := b.EmitArg(OpJMP_IF_FALSE, 0, s.Position().Line)
+
+		b.PushLoop(start)
+		c.loopBlocks = append(c.loopBlocks, c.scope.Depth())
+		err := c.compileBlock(b, s.Body)
+		c.loopBlocks = c.loopBlocks[:len(c.loopBlocks)-1]
+		if err != nil {
+			b.PopLoop()
+			return err
+		}
+		b.EmitArg(OpJMP, start, s.Position().Line)
+
+		b.PatchJump(jumpEnd)
+		// Patches all break jumps to the address after the loop
+		b.PopLoop()
+
+	case *parser.BreakStatement:
+		if !b.InLoop() {
+			return fmt.Errorf("'break' outside loop at line %d", s.Position().Line)
+		}
+		if len(c.loopBlocks) == 0 {
+			return fmt.Errorf("'break' cannot leave %s at line %d", c.fence, s.Position().Line)
+		}
+		c.emitEarlyFrees(b, s.Position().Line)
+		b.AddBreak(b.EmitArg(OpJMP, 0, s.Position().Line))
+
+	case *parser.ContinueStatement:
+		if !b.InLoop() {
+			return fmt.Errorf("'continue' outside loop at line %d", s.Position().Line)
+		}
+		if len(c.loopBlocks) == 0 {
+			return fmt.Errorf("'continue' cannot leave %s at line %d", c.fence, s.Position().Line)
+		}
+		c.emitEarlyFrees(b, s.Position().Line)
+		b.EmitArg(OpJMP, b.GetLoopStart(), s.Position().Line)
+
+	case *parser.AtomicStatement:
+		return c.compileAtomic(b, s)
+
+	case *parser.FunctionStatement:
+		return c.compileFunction(s)
+
+	case *parser.ReturnStatement:
+		return c.compileReturn(b, s)
 
 	case *parser.DiscardStatement:
 		return fmt.Errorf("discard statements not yet implemented")
@@ -234,6 +641,134 @@ func (c *Compiler) compileStatement(b *ByteCode, statement parser.Statement) err
 	return nil
 }
 
+// compileBlock compiles a nested block. Variables first defined inside the
+// block are freed when it ends; pointer aliases only go out of scope.
+func (c *Compiler) compileBlock(b *ByteCode, block *parser.BlockStatement) error {
+	c.scope.EnterBlock()
+	for _, stmt := range block.Statements {
+		if err := c.compileStatement(b, stmt); err != nil {
+			c.scope.ExitBlock()
+			return err
+		}
+	}
+	c.emitFrees(b, c.scope.ExitBlock(), block.Token.Position.Line)
+	return nil
+}
+
+// compileAtomic compiles an atomic block. ATOMIC_BEGIN holds the address
+// execution resumes at after a rollback: the else block, or the end of the
+// statement. Neither loops nor the function can be left from the body, since
+// its ATOMIC_END would be skipped.
+func (c *Compiler) compileAtomic(b *ByteCode, s *parser.AtomicStatement) error {
+	if c.scope == nil {
+		return fmt.Errorf("atomic block outside alloc block")
+	}
+	line := s.Position().Line
+	var handled byte
+	if s.Alternative != nil {
+		handled = 1
+	}
+	begin := b.EmitArgExtra(OpAtomicBEGIN, 0, handled, line)
+
+	outerLoops, outerFence := c.loopBlocks, c.fence
+	c.loopBlocks, c.fence = nil, "an atomic block"
+	c.atomics++
+	err := c.compileBlock(b, s.Body)
+	c.loopBlocks, c.fence = outerLoops, outerFence
+	c.atomics--
+	if err != nil {
+		return err
+	}
+	b.Emit(OpAtomicEND, line)
+
+	if s.Alternative == nil {
+		b.PatchJump(begin)
+		return nil
+	}
+	jumpEnd := b.EmitArg(OpJMP, 0, line)
+	b.PatchJump(begin)
+	if err := c.compileBlock(b, s.Alternative); err != nil {
+		return err
+	}
+	b.PatchJump(jumpEnd)
+	return nil
+}
+
+// compileAllocSize compiles the capacity or growth ceiling of an alloc
+// statement, which must be an integer.
+func (c *Compiler) compileAllocSize(b *ByteCode, what string, expr parser.Expression) error {
+	tag, err := c.inferTypeTag(expr)
+	if err != nil {
+		return fmt.Errorf("%s: %v", what, err)
+	}
+	if !isIndexTag(tag) {
+		name, _ := value.NameForTag(tag)
+		return fmt.Errorf("%s must be an integer, got %s", what, value.NameOrUnknown(name))
+	}
+	if err := c.compileExpression(b, expr); err != nil {
+		return fmt.Errorf("%s: %v", what, err)
+	}
+	return nil
+}
+
+// allocStrategy resolves the ':strategy' modifier of an alloc statement to
+// an allocator strategy and, for pools, the slot size.
+func allocStrategy(s *parser.AllocStatement) (alloc.Strategy, int, error) {
+	if s.Strategy == nil {
+		return alloc.StrategyFreeList, 0, nil
+	}
+	strategy, ok := alloc.StrategyForName(s.Strategy.Value)
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown allocator strategy '%s'", s.Strategy.Value)
+	}
+	if strategy != alloc.StrategyPool {
+		if s.StrategyArg != nil {
+			return 0, 0, fmt.Errorf("allocator strategy '%s' takes no argument", s.Strategy.Value)
+		}
+		return strategy, 0, nil
+	}
+	slotSize, ok := s.StrategyArg.(*parser.IntegerExpression)
+	if !ok || slotSize.Value <= 0 {
+		return 0, 0, fmt.Errorf("allocator strategy 'pool' needs a positive integer slot size, e.g. ':pool(4)'")
+	}
+	return strategy, int(slotSize.Value), nil
+}
+
+// emitFrees releases the memory of block locals that own it.
+func (c *Compiler) emitFrees(b *ByteCode, locals []SymbolInfo, line int) {
+	for _, info := range locals {
+		if info.Alias {
+			continue
+		}
+		b.EmitArgExtra(OpVarFREE, info.SlotID, FreeScoped, line)
+	}
+}
+
+// emitEarlyFrees releases the locals of the blocks that a break or continue
+// leaves. They only run on the path that jumps, while the code after the
+// jump still uses the locals, so they are marked for autoSize, which reads
+// the body in a straight line.
+func (c *Compiler) emitEarlyFrees(b *ByteCode, line int) {
+	start := b.CurrentAddr()
+	c.emitFrees(b, c.scope.LocalsSince(c.loopBlocks[len(c.loopBlocks)-1]), line)
+	for addr := start; addr < b.CurrentAddr(); addr++ {
+		b.Instructions[addr].Extra |= FreeEarly
+	}
+}
+
+// compileCondition compiles a condition expression that must be boolean.
+func (c *Compiler) compileCondition(b *ByteCode, expr parser.Expression) error {
+	tag, err := c.inferTypeTag(expr)
+	if err != nil {
+		return err
+	}
+	if tag != value.TagBoolean {
+		name, _ := value.NameForTag(tag)
+		return fmt.Errorf("condition must be boolean, got %s", name)
+	}
+	return c.compileExpression(b, expr)
+}
+
 func (c *Compiler) compileStructAssignment(b *ByteCode, s *parser.AssignmentStatement, structExpr *parser.StructExpression) error {
 	stencil, ok := c.stencils[structExpr.Name]
 	if !ok {
@@ -245,31 +780,16 @@ func (c *Compiler) compileStructAssignment(b *ByteCode, s *parser.AssignmentStat
 	if _, exists := c.scope.Lookup(name); !exists {
 		info := c.scope.Define(name, 0, 0)
 		// Store stencil reference in the symbol
-		sym := c.scope.symbols[name]
-		sym.Stencil = stencil
-		c.scope.symbols[name] = sym
+		info.Stencil = stencil
+		c.scope.Update(name, info)
 		// Emit stencil alloc: Argument=slotID, Offset=totalSize
-		b.EmitField(OpStencilALLOC, info.SlotID, stencil.TotalSize, 0, s.Position().Line)
+		b.Symbol(b.EmitField(OpStencilALLOC, info.SlotID, stencil.TotalSize, 0, s.Position().Line), name)
 	}
 
 	info, _ := c.scope.Lookup(name)
 
-	// Compile and store each field
-	for _, fieldName := range structExpr.Order {
-		fieldExpr := structExpr.Fields[fieldName]
-		field, ok := stencil.LookupField(fieldName)
-		if !ok {
-			return fmt.Errorf("struct '%s' has no field '%s'", structExpr.Name, fieldName)
-		}
-
-		if err := c.compileExpression(b, fieldExpr); err != nil {
-			return fmt.Errorf("failed to compile struct field '%s': %v", fieldName, err)
-		}
-
-		b.EmitField(OpFieldSTORE, info.SlotID, field.Offset, byte(field.Tag), s.Position().Line)
-	}
-
-	return nil
+	// Compile and store each field, recursing into nested struct literals
+	return c.compileStencilLiteral(b, info.SlotID, 0, stencil, structExpr, s.Position().Line)
 }
 
 func (c *Compiler) compileTupleAssignment(b *ByteCode, s *parser.AssignmentStatement, tupleExpr *parser.TupleExpression) error {
@@ -284,6 +804,10 @@ func (c *Compiler) compileTupleAssignment(b *ByteCode, s *parser.AssignmentState
 		if err != nil {
 			return fmt.Errorf("tuple element %d: %v", i, err)
 		}
+		if value.SizeForTag(tag) == 0 {
+			name, _ := value.NameForTag(tag)
+			return fmt.Errorf("tuple element %d: tuples hold fixed-size types only, got %s", i, name)
+		}
 		stencil.Fields = append(stencil.Fields, FieldLayout{
 			Name:   fmt.Sprintf("%d", i),
 			Offset: offset,
@@ -297,10 +821,9 @@ func (c *Compiler) compileTupleAssignment(b *ByteCode, s *parser.AssignmentState
 
 	if _, exists := c.scope.Lookup(name); !exists {
 		info := c.scope.Define(name, 0, 0)
-		sym := c.scope.symbols[name]
-		sym.Stencil = stencil
-		c.scope.symbols[name] = sym
-		b.EmitField(OpStencilALLOC, info.SlotID, stencil.TotalSize, 0, s.Position().Line)
+		info.Stencil = stencil
+		c.scope.Update(name, info)
+		b.Symbol(b.EmitField(OpStencilALLOC, info.SlotID, stencil.TotalSize, 0, s.Position().Line), name)
 	}
 
 	info, _ := c.scope.Lookup(name)
@@ -361,7 +884,10 @@ func (c *Compiler) compileExpression(b *ByteCode, expr parser.Expression) error
 		constIdx := b.AddConstant(Constant{Tag: value.TagBoolean, Data: data})
 		b.EmitArg(OpLoadCONST, constIdx, e.Position().Line)
 	case *parser.StringExpression:
-		return fmt.Errorf("string literals are not allocable")
+		constIdx := b.AddConstant(Constant{Tag: value.TagString, Data: []byte(e.Value)})
+		b.EmitArg(OpLoadCONST, constIdx, e.Position().Line)
+	case *parser.InterpolatedExpression:
+		return c.compileInterpolation(b, e)
 	case *parser.NilExpression:
 		return fmt.Errorf("nil literals are not allocable")
 	case *parser.IdentifierExpression:
@@ -372,49 +898,166 @@ func (c *Compiler) compileExpression(b *ByteCode, expr parser.Expression) error
 		if !exists {
 			return fmt.Errorf("undefined variable '%s'", e.Value)
 		}
-		b.EmitArg(OpVarLOAD, info.SlotID, e.Position().Line)
+		if info.Array {
+			return fmt.Errorf("array '%s' must be indexed", e.Value)
+		}
+		if info.Stencil != nil {
+			return fmt.Errorf("'%s' is a %s; copy it with assignment or access its fields", e.Value, describeStencil(info.Stencil))
+		}
+		emitSlotLoad(b, info, e.Position().Line)
+	case *parser.IndexExpression:
+		if tag, err := c.inferTypeTag(e.Left); err == nil && tag == value.TagString {
+			if err := c.compileExpression(b, e.Left); err != nil {
+				return err
+			}
+			if err := c.compileIndex(b, e.Index); err != nil {
+				return err
+			}
+			b.Emit(OpStrINDEX, e.Position().Line)
+			break
+		}
+		info, err := c.lookupArray(e.Left)
+		if err != nil {
+			return err
+		}
+		if err := c.compileIndex(b, e.Index); err != nil {
+			return err
+		}
+		b.EmitArgExtra(OpArrayLOAD, info.SlotID, byte(info.Tag), e.Position().Line)
 	case *parser.AttributeExpression:
 		// Field access on a struct/tuple: obj.field or obj.0
-		ident, ok := e.Object.(*parser.IdentifierExpression)
+		info, field, err := c.lookupPrimitiveField(e)
+		if err != nil {
+			return err
+		}
+		b.EmitField(OpFieldLOAD, info.SlotID, field.Offset, byte(field.Tag), e.Position().Line)
+	case *parser.GroupedExpression:
+		return c.compileExpression(b, e.Expr)
+	case *parser.CallExpression:
+		if _, in, ok := lookupIntrinsic(e.Function); ok {
+			return in.compile(c, b, e.Arguments, e.Position().Line)
+		}
+		ident, ok := e.Function.(*parser.IdentifierExpression)
 		if !ok {
-			return fmt.Errorf("field access requires an identifier, got %T", e.Object)
+			return fmt.Errorf("only identifier function calls are supported, got %T", e.Function)
 		}
-		if c.scope == nil {
-			return fmt.Errorf("identifier '%s' outside alloc block", ident.Value)
+		fn, index, ok := c.LookupFunction(ident.Value)
+		if !ok {
+			sig, ok := LookupNativeSignature(ident.Value)
+			if !ok {
+				return fmt.Errorf("undefined function '%s'", ident.Value)
+			}
+			if _, err := sig.singleReturn(); err != nil {
+				return err
+			}
+			_, err := c.compileNativeCall(b, ident.Value, e.Arguments, e.Position().Line)
+			return err
 		}
-		info, exists := c.scope.Lookup(ident.Value)
-		if !exists {
-			return fmt.Errorf("undefined variable '%s'", ident.Value)
+		if fn.Returns == 0 && fn != c.function {
+			return fmt.Errorf("function '%s' does not return a value", fn.Name)
+		}
+		return c.compileFunctionCall(b, fn, index, e.Arguments, e.Position().Line)
+	case *parser.PrefixExpression:
+		// Validate operand types at compile time where they are known
+		if _, err := c.inferTypeTag(e); err != nil {
+			return err
+		}
+		if err := c.compileExpression(b, e.Right); err != nil {
+			return err
+		}
+		if e.Operator == "!" {
+			b.Emit(OpLogicNOT, e.Position().Line)
+		} else {
+			b.Emit(OpArithNEG, e.Position().Line)
 		}
-		if info.Stencil == nil {
-			return fmt.Errorf("variable '%s' is not a struct or tuple", ident.Value)
+	case *parser.InfixExpression:
+		if _, ok, err := c.inferStencilInfix(e); ok {
+			if err != nil {
+				return err
+			}
+			return c.compileStencilCompare(b, e)
+		}
+		if _, err := c.inferTypeTag(e); err != nil {
+			return err
 		}
-		fieldName := e.Attribute.Value
-		field, ok := info.Stencil.LookupField(fieldName)
+		if e.Operator == "&&" || e.Operator == "||" {
+			return c.compileLogicalExpression(b, e)
+		}
+		op, ok := arithmeticOperations[e.Operator]
 		if !ok {
-			return fmt.Errorf("struct '%s' has no field '%s'", info.Stencil.Name, fieldName)
+			op, ok = comparisonOperations[e.Operator]
 		}
-		b.EmitField(OpFieldLOAD, info.SlotID, field.Offset, byte(field.Tag), e.Position().Line)
+		if e.Operator == "+" {
+			// Types were validated above, so one string operand means concatenation
+			if tag, _ := c.inferTypeTag(e.Left); tag == value.TagString {
+				op = OpStrCONCAT
+			}
+		}
+		if !ok {
+			return fmt.Errorf("unsupported operator '%s'", e.Operator)
+		}
+		if err := c.compileExpression(b, e.Left); err != nil {
+			return err
+		}
+		if err := c.compileExpression(b, e.Right); err != nil {
+			return err
+		}
+		b.Emit(op, e.Position().Line)
 	default:
 		return fmt.Errorf("unknown expression type: %T", e)
 	}
 	return nil
 }
 
-func (c *Compiler) resolveConstraintMask(constraints []parser.Expression) (byte, error) {
+// compileLogicalExpression lowers '&&' and '||' into conditional jumps so the
+// right operand is only evaluated when it decides the result:
+//
+//	left; DUP; JMP_IF_FALSE end; POP; right; end:   (&&)
+//	left; DUP; JMP_IF_TRUE end; POP; right; end:    (||)
+func (c *Compiler) compileLogicalExpression(b *ByteCode, e *parser.InfixExpression) error {
+	line := e.Position().Line
+	if err := c.compileExpression(b, e.Left); err != nil {
+		return err
+	}
+	b.Emit(OpStackDUP, line)
+
+	op := OpJMP_IF_FALSE
+	if e.Operator == "||" {
+		op = OpJMP_IF_TRUE
+	}
+	jump := b.EmitArg(op, 0, line)
+
+	b.Emit(OpStackPOP, line)
+	if err := c.compileExpression(b, e.Right); err != nil {
+		return err
+	}
+	b.PatchJump(jump)
+	return nil
+}
+
+// resolveConstraints resolves type constraints to the slot's initial tag and
+// its mask of allowed tags. A string constraint must stand alone and yields
+// TagString with an empty mask, since strings have no bit in the type masks.
+func (c *Compiler) resolveConstraints(constraints []parser.Expression) (value.TypeTag, byte, error) {
 	var mask byte
 	for _, constraint := range constraints {
 		ident, ok := constraint.(*parser.IdentifierExpression)
 		if !ok {
-			return 0, fmt.Errorf("type constraint must be an identifier, got %T", constraint)
+			return 0, 0, fmt.Errorf("type constraint must be an identifier, got %T", constraint)
 		}
 		tag, ok := value.TagForName(ident.Value)
 		if !ok {
-			return 0, fmt.Errorf("unknown type name '%s'", ident.Value)
+			return 0, 0, fmt.Errorf("unknown type name '%s'", ident.Value)
+		}
+		if tag == value.TagString {
+			if len(constraints) > 1 {
+				return 0, 0, fmt.Errorf("string cannot be part of a union")
+			}
+			return value.TagString, 0, nil
 		}
 		mask |= value.MaskForTag(tag)
 	}
-	return mask, nil
+	return lowestTagInMask(mask), mask, nil
 }
 
 func (c *Compiler) inferTypeTag(expr parser.Expression) (value.TypeTag, error) {
@@ -435,6 +1078,8 @@ func (c *Compiler) inferTypeTag(expr parser.Expression) (value.TypeTag, error) {
 		return value.TagBoolean, nil
 	case *parser.CharExpression:
 		return value.TagChar, nil
+	case *parser.StringExpression, *parser.InterpolatedExpression:
+		return value.TagString, nil
 	case *parser.PointerExpression:
 		tag, ok := value.TagForName(expr.TypeName)
 		if !ok {
@@ -445,24 +1090,121 @@ func (c *Compiler) inferTypeTag(expr parser.Expression) (value.TypeTag, error) {
 		e := expr
 		if c.scope != nil {
 			if info, ok := c.scope.Lookup(e.Value); ok {
+				if info.Array {
+					return 0, fmt.Errorf("array '%s' must be indexed", e.Value)
+				}
+				if info.Stencil != nil {
+					return 0, fmt.Errorf("'%s' is a %s; copy it with assignment or access its fields", e.Value, describeStencil(info.Stencil))
+				}
 				return info.Tag, nil
 			}
 		}
 		return 0, fmt.Errorf("cannot infer type from undefined variable '%s'", e.Value)
 	case *parser.AttributeExpression:
-		ident, ok := expr.Object.(*parser.IdentifierExpression)
+		_, field, err := c.lookupPrimitiveField(expr)
+		if err != nil {
+			return 0, err
+		}
+		return field.Tag, nil
+	case *parser.GroupedExpression:
+		return c.inferTypeTag(expr.Expr)
+	case *parser.IndexExpression:
+		if tag, err := c.inferTypeTag(expr.Left); err == nil && tag == value.TagString {
+			// Indexing a string yields its bytes
+			return value.TagByte, nil
+		}
+		info, err := c.lookupArray(expr.Left)
+		if err != nil {
+			return 0, err
+		}
+		return info.Tag, nil
+	case *parser.CallExpression:
+		if _, in, ok := lookupIntrinsic(expr.Function); ok {
+			return in.infer(c, expr.Arguments)
+		}
+		ident, ok := expr.Function.(*parser.IdentifierExpression)
 		if !ok {
-			return 0, fmt.Errorf("cannot infer type from non-identifier attribute access")
+			return 0, fmt.Errorf("cannot infer type from call to %T", expr.Function)
 		}
-		if c.scope != nil {
-			if info, ok := c.scope.Lookup(ident.Value); ok && info.Stencil != nil {
-				if field, ok := info.Stencil.LookupField(expr.Attribute.Value); ok {
-					return field.Tag, nil
+		fn, _, ok := c.LookupFunction(ident.Value)
+		if !ok {
+			sig, ok := LookupNativeSignature(ident.Value)
+			if !ok {
+				return 0, fmt.Errorf("undefined function '%s'", ident.Value)
+			}
+			return sig.singleReturn()
+		}
+		if fn.Returns == 0 {
+			if fn == c.function {
+				return 0, fmt.Errorf("cannot infer return type of '%s' before its first return; declare it as 'fn %s(...): type'", fn.Name, fn.Name)
+			}
+			return 0, fmt.Errorf("function '%s' does not return a value", fn.Name)
+		}
+		return fn.Returns, nil
+	case *parser.PrefixExpression:
+		tag, err := c.inferTypeTag(expr.Right)
+		if err != nil {
+			return 0, err
+		}
+		switch expr.Operator {
+		case "!":
+			if tag != value.TagBoolean {
+				name, _ := value.NameForTag(tag)
+				return 0, fmt.Errorf("operator '!' not defined for %s", name)
+			}
+			return value.TagBoolean, nil
+		case "-":
+		default:
+			return 0, fmt.Errorf("unsupported prefix operator '%s'", expr.Operator)
+		}
+		if !value.IsNumericTag(tag) {
+			name, _ := value.NameForTag(tag)
+			return 0, fmt.Errorf("operator '-' not defined for %s", name)
+		}
+		return tag, nil
+	case *parser.InfixExpression:
+		if tag, ok, err := c.inferStencilInfix(expr); ok {
+			return tag, err
+		}
+		left, err := c.inferTypeTag(expr.Left)
+		if err != nil {
+			return 0, err
+		}
+		right, err := c.inferTypeTag(expr.Right)
+		if err != nil {
+			return 0, err
+		}
+		if left == value.TagString || right == value.TagString {
+			return inferStringInfix(expr.Operator, left, right)
+		}
+		if expr.Operator == "&&" || expr.Operator == "||" {
+			if left != value.TagBoolean || right != value.TagBoolean {
+				leftName, _ := value.NameForTag(left)
+				rightName, _ := value.NameForTag(right)
+				return 0, fmt.Errorf("operator '%s' requires boolean operands, got %s and %s", expr.Operator, leftName, rightName)
+			}
+			return value.TagBoolean, nil
+		}
+		if _, ok := comparisonOperations[expr.Operator]; ok {
+			if left == value.TagBoolean && right == value.TagBoolean {
+				if expr.Operator != "==" && expr.Operator != "!=" {
+					return 0, fmt.Errorf("operator '%s' not defined for boolean", expr.Operator)
 				}
-				return 0, fmt.Errorf("struct '%s' has no field '%s'", info.Stencil.Name, expr.Attribute.Value)
+				return value.TagBoolean, nil
 			}
+			if _, err := value.Promote(left, right); err != nil {
+				return 0, fmt.Errorf("operator '%s': %v", expr.Operator, err)
+			}
+			return value.TagBoolean, nil
+		}
+		if _, ok := arithmeticOperations[expr.Operator]; !ok {
+			return 0, fmt.Errorf("unsupported operator '%s'", expr.Operator)
 		}
-		return 0, fmt.Errorf("cannot infer type from attribute expression")
+		tag, err := value.Promote(left, right)
+		if err != nil {
+			return 0, fmt.Errorf("operator '%s': %v", expr.Operator, err)
+		}
+		return tag, nil
 	default:
 		return 0, fmt.Errorf("cannot infer type from expression %T", expr)
 	}
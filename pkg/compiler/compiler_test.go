@@ -1,7 +1,9 @@
 package compiler_test
 
 import (
+	"bytes"
 	"context"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -16,8 +18,16 @@ import (
 )
 
 type TestCompilerCase struct {
-	Source string
-	Error  *TestCompilerError
+	Source   string
+	Output   string   // expected stdout; checked only when non-empty
+	Stderr   string   // expected stderr; checked when non-empty or with Leaks
+	Strict   bool     // compile in strict mode
+	Sanitize bool     // run with the memory sanitizer
+	Leaks    bool     // run with the leak check
+	Growths  []int    // expected capacities after each arena growth; checked only when non-empty
+	Disasm   string   // expected substring of the disassembly; checked only when non-empty
+	Warnings []string // expected diagnostics of the lifetime analysis
+	Error    *TestCompilerError
 }
 
 type TestCompilerError struct {
@@ -586,21 +596,2983 @@ var CaseFactories = map[string]TestCompilerCaseFactory{
 			},
 		}
 	},
+	"arith-precedence": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				a = 3
+				b = 4
+				x = a + b * 2
+				print(x)
+			}
+			`,
+			Output: "11\n",
+		}
+	},
+	"arith-grouped": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				a = 3
+				x = (a + 4) * 2 - 10 / 3 % 2
+				print(x)
+			}
+			`,
+			Output: "13\n",
+		}
+	},
+	"arith-negative": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				x = 5
+				y = -x - 2
+				print(y)
+			}
+			`,
+			Output: "-7\n",
+		}
+	},
+	"arith-promotion": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				s = 2s + 3
+				f = 1.5f * 2
+				d = 7l + 0.5f
+				type(s)
+				type(f)
+				type(d)
+				print(s, f, d)
+			}
+			`,
+			Output: "(int)\n(float)\n(decimal)\n5 3 7.5\n",
+		}
+	},
+	"arith-byte-wraps": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				b = 250b + 10b
+				print(b)
+			}
+			`,
+			Output: "4\n",
+		}
+	},
+	"arith-reassign": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				x = 1
+				x = x + 1
+				x = x * x
+				print(x)
+			}
+			`,
+			Output: "4\n",
+		}
+	},
+	"arith-division-by-zero": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				x = 0
+				y = 10 / x
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "division by zero",
+			},
+		}
+	},
+	"arith-boolean-operand": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				x = 1 + true
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "operation not defined between int and boolean",
+			},
+		}
+	},
+	"arith-type-mismatch-store": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				x = 1
+				x = x + 2l
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "type mismatch",
+			},
+		}
+	},
+	"compare-integers": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				a = 3
+				b = 4
+				lt = a < b
+				eq = a == b
+				ge = a + 1 >= b
+				print(lt, eq, ge)
+			}
+			`,
+			Output: "true false true\n",
+		}
+	},
+	"compare-mixed-numeric": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				a = 2s < 3l
+				b = 4 == 4.0
+				c = 7b > -1
+				d = 'A' == 65
+				print(a, b, c, d)
+			}
+			`,
+			Output: "true true true true\n",
+		}
+	},
+	"compare-boolean-ordering": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				x = true < false
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "operator '<' not defined for boolean",
+			},
+		}
+	},
+	"compare-boolean-with-int": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				x = true == 1
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "operation not defined between boolean and int",
+			},
+		}
+	},
+	"logic-not": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				x = !(1 > 2)
+				y = !x
+				print(x, y)
+			}
+			`,
+			Output: "true false\n",
+		}
+	},
+	"logic-short-circuit-and": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				z = 0
+				x = z != 0 && 10 / z > 1
+				print(x)
+			}
+			`,
+			Output: "false\n",
+		}
+	},
+	"logic-short-circuit-or": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				z = 0
+				x = z == 0 || 10 / z > 1
+				y = false || z < 1 && true
+				print(x, y)
+			}
+			`,
+			Output: "true true\n",
+		}
+	},
+	"logic-non-boolean-operand": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				x = 1 && true
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "requires boolean operands",
+			},
+		}
+	},
+	"if-true-branch": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				x = 5
+				if x > 3 {
+					print(1)
+				}
+				print(2)
+			}
+			`,
+			Output: "1\n2\n",
+		}
+	},
+	"if-else": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				x = 2
+				if x > 3 {
+					print(1)
+				} else {
+					print(0)
+				}
+			}
+			`,
+			Output: "0\n",
+		}
+	},
+	"if-else-if-chain": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				x = 15
+				if x < 10 {
+					print(1)
+				} else if x < 20 {
+					print(2)
+				} else {
+					print(3)
+				}
+			}
+			`,
+			Output: "2\n",
+		}
+	},
+	"if-identifier-condition": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				ok = true
+				if ok {
+					y = 7
+					print(y)
+				}
+			}
+			`,
+			Output: "7\n",
+		}
+	},
+	"if-block-local-out-of-scope": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				if true {
+					y = 7
+				}
+				z = y
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "undefined variable 'y'",
+			},
+		}
+	},
+	"if-block-local-freed": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				if true {
+					a = 1l
+				}
+				b = 2l
+			}
+			`,
+		}
+	},
+	"if-non-boolean-condition": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				x = 1
+				if x {
+					print(x)
+				}
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "condition must be boolean, got int",
+			},
+		}
+	},
+	"while-counter": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				i = 0
+				sum = 0
+				while i < 5 {
+					sum = sum + i
+					i = i + 1
+				}
+				print(sum)
+			}
+			`,
+			Output: "10\n",
+		}
+	},
+	"while-break-continue": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				i = 0
+				while true {
+					i = i + 1
+					if i % 2 == 0 {
+						continue
+					}
+					if i > 7 {
+						break
+					}
+					print(i)
+				}
+			}
+			`,
+			Output: "1\n3\n5\n7\n",
+		}
+	},
+	"while-locals-released-per-iteration": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 24 {
+				i = 0
+				while i < 100 {
+					tmp = 1l
+					if i == 50 {
+						inner = 2l
+						break
+					}
+					i = i + 1
+				}
+				print(i)
+			}
+			`,
+			Output: "50\n",
+		}
+	},
+	"break-outside-loop": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				x = 1
+				break
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "'break' outside loop at line 4",
+			},
+		}
+	},
+	"continue-outside-loop": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				if true {
+					continue
+				}
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "'continue' outside loop at line 4",
+			},
+		}
+	},
+	"fn-add": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			fn add(a: int, b: int) { return a + b }
+			alloc 16 {
+				x = add(2, 3)
+				print(x)
+				print(add(x, 10))
+			}
+			`,
+			Output: "5\n15\n",
+		}
+	},
+	"fn-void-call-statement": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			fn show(v: int) {
+				if v < 0 {
+					print(0)
+					return
+				}
+				print(v)
+			}
+			alloc 16 {
+				show(-4)
+				show(4)
+			}
+			`,
+			Output: "0\n4\n",
+		}
+	},
+	"fn-recursion": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			fn fib(n: int): int {
+				if n < 2 {
+					return n
+				}
+				return fib(n - 1) + fib(n - 2)
+			}
+			alloc 128 {
+				print(fib(15))
+			}
+			`,
+			Output: "610\n",
+		}
+	},
+	"fn-locals-released-on-return": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			fn square(v: long) {
+				tmp = v * v
+				return tmp
+			}
+			alloc 32 {
+				i = 0
+				total = 0l
+				while i < 10 {
+					total = total + square(2l)
+					i = i + 1
+				}
+				print(total)
+			}
+			`,
+			Output: "40\n",
+		}
+	},
+	"fn-stack-overflow": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			fn forever(n: int): int {
+				return forever(n + 1)
+			}
+			alloc 4096 {
+				x = forever(0)
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "stack overflow",
+			},
+		}
+	},
+	"fn-argument-type-mismatch": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			fn half(v: int) { return v / 2 }
+			alloc 16 {
+				x = half(true)
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "argument 0 of call to 'half': type mismatch",
+			},
+		}
+	},
+	"fn-missing-return": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			fn sign(v: int) {
+				if v < 0 {
+					return -1
+				}
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "missing return",
+			},
+		}
+	},
+	"fn-outer-variable-not-visible": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			fn peek(v: int) { return v + x }
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "undefined variable 'x'",
+			},
+		}
+	},
+	"native-return-assign": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				t = clock()
+				print(t > 0l)
+			}
+			`,
+			Output: "true\n",
+		}
+	},
+	"native-return-in-expression": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				x = answer() + 1
+				print(x)
+			}
+			`,
+			Output: "43\n",
+		}
+	},
+	"native-return-discarded": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				clock()
+				pair()
+				print(1)
+			}
+			`,
+			Output: "1\n",
+		}
+	},
+	"native-void-in-expression": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				x = print(1)
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "native function 'print' does not return a value",
+			},
+		}
+	},
+	"native-multiple-returns-in-expression": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				x = pair()
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "native function 'pair' returns 2 values",
+			},
+		}
+	},
+	"native-undefined-in-expression": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				x = nothing()
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "undefined function 'nothing'",
+			},
+		}
+	},
+	"array-store-load": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 256 {
+				buf: int[8]
+				i = 0
+				while i < len(buf) {
+					buf[i] = i * i
+					i = i + 1
+				}
+				print(buf[3], buf[7], len(buf))
+			}
+			`,
+			Output: "9 49 8\n",
+		}
+	},
+	"array-starts-zeroed": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				junk = 123456789l
+				free(junk)
+				buf: short[4]
+				print(buf[0], buf[3])
+			}
+			`,
+			Output: "0 0\n",
+		}
+	},
+	"array-out-of-memory": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 64 {
+				buf: long[64]
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "out of memory: need 512 bytes",
+			},
+		}
+	},
+	"array-index-out-of-bounds": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				buf: int[4]
+				i = 4
+				buf[i] = 1
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "index 4 out of bounds for array of length 4",
+			},
+		}
+	},
+	"array-negative-index": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				buf: int[4]
+				x = buf[-1]
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "index -1 out of bounds",
+			},
+		}
+	},
+	"array-element-type-mismatch": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				buf: int[4]
+				buf[0] = 1l
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "array 'buf' holds int, got long",
+			},
+		}
+	},
+	"array-index-not-integer": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				buf: int[4]
+				x = buf[1.5f]
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "array index must be an integer, got float",
+			},
+		}
+	},
+	"array-must-be-indexed": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				buf: int[4]
+				x = buf
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "array 'buf' must be indexed",
+			},
+		}
+	},
+	"array-released-at-block-exit": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 48 {
+				i = 0
+				while i < 10 {
+					tmp: long[4]
+					tmp[0] = 1l
+					i = i + 1
+				}
+				print(i)
+			}
+			`,
+			Output: "10\n",
+		}
+	},
+	"declaration-uninitialized": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				count: int|long
+				x = count
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "is uninitialized",
+			},
+		}
+	},
+	"string-assign-print": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				path = "/state/counter"
+				print(path, len(path))
+			}
+			`,
+			Output: "/state/counter 14\n",
+		}
+	},
+	"string-concat-grows-slot": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 20 {
+				s = "ab"
+				s = s + "cdef"
+				s = s + "!"
+				print(s)
+			}
+			`,
+			Output: "abcdef!\n",
+		}
+	},
+	"string-shorter-value-reuses-slot": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 20 {
+				i = 0
+				s = "abcdefgh"
+				while i < 10 {
+					s = "abc"
+					s = "abcdefgh"
+					i = i + 1
+				}
+				print(s)
+			}
+			`,
+			Output: "abcdefgh\n",
+		}
+	},
+	"string-compare": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				a = "apple"
+				print(a == "apple", a != "apple", a < "banana", "b" >= a)
+			}
+			`,
+			Output: "true false true true\n",
+		}
+	},
+	"string-index-byte": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				s = "AZ"
+				first = s[0]
+				print(first, s[1])
+			}
+			`,
+			Output: "65 90\n",
+		}
+	},
+	"string-function-argument-and-return": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			fn greet(name: string): string {
+				return "hello, " + name
+			}
+			alloc 64 {
+				g = greet("vega")
+				print(g)
+			}
+			`,
+			Output: "hello, vega\n",
+		}
+	},
+	"string-index-out-of-bounds": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				s = "abc"
+				b = s[3]
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "index 3 out of bounds for string of length 3",
+			},
+		}
+	},
+	"string-out-of-memory": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				s = "too long for this arena"
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "out of memory",
+			},
+		}
+	},
+	"string-immutable": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				s = "abc"
+				s[0] = 1b
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "strings are immutable",
+			},
+		}
+	},
+	"string-into-int-slot": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				x = 1
+				x = "one"
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "type mismatch: 'x' holds int, got string",
+			},
+		}
+	},
+	"string-in-union": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				x: int|string = 1
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "string cannot be part of a union",
+			},
+		}
+	},
+	"string-arithmetic": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				x = "a" + 1
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "operator '+' not defined between string and int",
+			},
+		}
+	},
+	// String interpolation tests
+	"interp-slot-and-field": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			struct point {
+				x: int
+				y: int
+			}
+			alloc 64 {
+				x = 3
+				p = point { x = 1, y = 2 }
+				print("slot ${x} has ${p.y}")
+			}
+			`,
+			Output: "slot 3 has 2\n",
+		}
+	},
+	"interp-all-primitive-tags": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				print("${1b} ${2s} ${3} ${4l} ${'v'} ${true} ${0.5}")
+			}
+			`,
+			Output: "1 2 3 4 v true 0.5\n",
+		}
+	},
+	"interp-union-uses-current-tag": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				x: int | decimal = 7
+				print("x=${x}")
+				x = 2.5
+				print("x=${x}")
+			}
+			`,
+			Output: "x=7\nx=2.5\n",
+		}
+	},
+	"interp-expressions-and-escape": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 64 {
+				a = 2
+				s = "sum=${a + 3} len=${len("abc")} raw=\${a}"
+				print(s)
+				print(len("${a}${a}"))
+			}
+			`,
+			Output: "sum=5 len=3 raw=${a}\n2\n",
+		}
+	},
+	"interp-empty-expression": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				print("a${}b")
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "parse",
+				Message: "empty expression in interpolated string",
+			},
+		}
+	},
+	"interp-undefined-variable": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				print("a${y}")
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "interpolation '${y}': undefined variable 'y'",
+			},
+		}
+	},
+	// Field assignment tests
+	"field-assign-struct": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			struct point {
+				x: int
+				y: int
+			}
+			alloc 32 {
+				p = point { x = 1, y = 2 }
+				p.x = 42
+				p.y = p.x + p.y
+				print(p.x, p.y)
+			}
+			`,
+			Output: "42 44\n",
+		}
+	},
+	"field-assign-tuple": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				t = (1, false)
+				t.1 = true
+				t.0 = 7
+				print(t.0, t.1)
+			}
+			`,
+			Output: "7 true\n",
+		}
+	},
+	"field-assign-type-mismatch": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				t = (1, false)
+				t.1 = 3
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "value for field 't.1': literal 3 cannot be stored as boolean at line 4, column 11",
+			},
+		}
+	},
+	"field-assign-unknown-field": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			struct point {
+				x: int
+				y: int
+			}
+			alloc 32 {
+				p = point { x = 1, y = 2 }
+				p.z = 3
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "struct 'point' has no field 'z'",
+			},
+		}
+	},
+	"field-assign-not-a-struct": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				x = 1
+				x.y = 2
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "variable 'x' is not a struct or tuple",
+			},
+		}
+	},
+	// Nested stencil tests
+	"nested-struct-literal-and-access": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			struct coord {
+				x: int
+				y: int
+			}
+			struct entry {
+				pos: coord
+				flags: byte
+			}
+			alloc 32 {
+				e = entry { pos = coord { x = 1, y = 2 }, flags = 3b }
+				print(e.pos.x, e.pos.y, e.flags)
+			}
+			`,
+			Output: "1 2 3\n",
+		}
+	},
+	"nested-struct-field-store": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			struct coord {
+				x: int
+				y: int
+			}
+			struct segment {
+				a: coord
+				b: coord
+			}
+			alloc 32 {
+				s = segment { a = coord { x = 1, y = 2 }, b = coord { x = 3, y = 4 } }
+				s.b.y = 40
+				s.a = coord { x = 10, y = 20 }
+				print(s.a.x, s.a.y, s.b.x, s.b.y)
+			}
+			`,
+			Output: "10 20 3 40\n",
+		}
+	},
+	"nested-registered-stencil": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				n = gonested { rec = gorecord { id = 7, active = true }, count = 2b }
+				print(n.rec.id, n.rec.active, n.count)
+			}
+			`,
+			Output: "7 true 2\n",
+		}
+	},
+	"nested-struct-load-whole": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			struct coord {
+				x: int
+				y: int
+			}
+			struct entry {
+				pos: coord
+				flags: byte
+			}
+			alloc 32 {
+				e = entry { pos = coord { x = 1, y = 2 }, flags = 3b }
+				print(e.pos)
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "field 'e.pos' is a struct 'coord'; access one of its fields",
+			},
+		}
+	},
+	"nested-struct-not-a-struct": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			struct coord {
+				x: int
+				y: int
+			}
+			struct entry {
+				pos: coord
+				flags: byte
+			}
+			alloc 32 {
+				e = entry { pos = coord { x = 1, y = 2 }, flags = 3b }
+				e.flags.x = 1
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "field 'e.flags' is not a struct",
+			},
+		}
+	},
+	// Stencil copy and equality tests
+	"stencil-copy-snapshot": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			struct point {
+				x: int
+				y: int
+			}
+			alloc 32 {
+				p = point { x = 1, y = 2 }
+				q = p
+				p.x = 10
+				print(p.x, q.x, q.y)
+				q = p
+				print(q.x)
+			}
+			`,
+			Output: "10 1 2\n10\n",
+		}
+	},
+	"stencil-equality": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			struct point {
+				x: int
+				y: int
+			}
+			alloc 32 {
+				p = point { x = 1, y = 2 }
+				q = p
+				print(p == q, p != q)
+				q.y = 3
+				print(p == q, p != q)
+			}
+			`,
+			Output: "true false\nfalse true\n",
+		}
+	},
+	"stencil-copy-tuple": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				t = (1, true)
+				u = t
+				t.1 = false
+				print(u.0, u.1, u == t)
+			}
+			`,
+			Output: "1 true false\n",
+		}
+	},
+	"stencil-copy-layout-mismatch": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			struct point {
+				x: int
+				y: int
+			}
+			alloc 32 {
+				p = point { x = 1, y = 2 }
+				t = (1, 2)
+				t = p
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "type mismatch: 't' holds tuple, got struct 'point'",
+			},
+		}
+	},
+	"stencil-compare-unsupported-operator": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			struct point {
+				x: int
+				y: int
+			}
+			alloc 32 {
+				p = point { x = 1, y = 2 }
+				q = p
+				b = p < q
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "operator '<' not defined for structs and tuples",
+			},
+		}
+	},
+	"stencil-used-as-value": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			struct point {
+				x: int
+				y: int
+			}
+			alloc 32 {
+				p = point { x = 1, y = 2 }
+				print(p)
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "'p' is a struct 'point'",
+			},
+		}
+	},
+	// Conversion intrinsic tests
+	"convert-widen-and-narrow": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				x: long = long(5)
+				y = short(x) + 1s
+				print(x, y, byte(300), short(70000))
+			}
+			`,
+			Output: "5 6 44 4464\n",
+		}
+	},
+	"convert-float-truncation": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				print(int(2.9), int(-2.9), int(10000000000.0), byte(-1.5), int(0.0 / 0.0))
+			}
+			`,
+			Output: "2 -2 2147483647 0 0\n",
+		}
+	},
+	"convert-float-rounding": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				print(float(3), decimal(float(0.1)), decimal(1.5f))
+			}
+			`,
+			Output: "3 0.10000000149011612 1.5\n",
+		}
+	},
+	"convert-bool-and-char": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				print(bool(0), bool(7), int(true), char(65), byte('A'))
+			}
+			`,
+			Output: "false true 1 A 65\n",
+		}
+	},
+	"convert-string-rejected": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				x = int("42")
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "cannot convert string to int",
+			},
+		}
+	},
+	"convert-argument-count": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				x = long(1, 2)
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "long expects 1 argument, got 2",
+			},
+		}
+	},
+	"convert-strict-exact": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				print(byte(255), int(2.0), bool(1), float(16777216))
+			}
+			`,
+			Strict: true,
+			Output: "255 2 true 16777216\n",
+		}
+	},
+	"convert-strict-overflow": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				x = byte(300)
+			}
+			`,
+			Strict: true,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "lossy conversion from int 300 to byte",
+			},
+		}
+	},
+	"convert-strict-fraction": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				x = int(2.5)
+			}
+			`,
+			Strict: true,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "lossy conversion from decimal 2.5 to int",
+			},
+		}
+	},
+	"convert-strict-rounding": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				x = float(16777217)
+			}
+			`,
+			Strict: true,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "lossy conversion from int 16777217 to float",
+			},
+		}
+	},
+	"literal-coerced-to-long": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				count: long = 0
+				count = count + 3l
+				f: float = 1.5
+				print(count, f)
+			}
+			`,
+			Output: "3 1.5\n",
+		}
+	},
+	"literal-coerced-to-narrowest": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				x: short | long = 70000
+				x = x + 1l
+				print(x)
+			}
+			`,
+			Output: "70001\n",
+		}
+	},
+	"literal-coerced-into-fields-and-arguments": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			struct rgb { r: byte, g: byte, b: byte }
+			fn grow(v: long) { return v * 2l }
+			alloc 64 {
+				buf: byte[4]
+				buf[1] = 250
+				c = rgb { r = 1, g = 2, b = 3 }
+				c.g = 200
+				print(buf[1], c.g, grow(21))
+			}
+			`,
+			Output: "250 200 42\n",
+		}
+	},
+	"literal-out-of-range": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				b: byte = 300
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "literal 300 out of range for byte at line 3, column 15",
+			},
+		}
+	},
+	"literal-negative-out-of-range": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				b: byte = 1
+				b = -1
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "literal -1 out of range for byte",
+			},
+		}
+	},
+	"literal-no-numeric-tag-fits": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				x: long = 1.5
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "value for 'x': literal 1.5 cannot be stored as long at line 3, column 15",
+			},
+		}
+	},
+	"literal-not-numeric-mask": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				ok: bool|char = 1
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "literal 1 cannot be stored as boolean|char at line 3, column 21",
+			},
+		}
+	},
+	"alloc-bump-rewinds-block-locals": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			fn bumpSquare(v: int) {
+				tmp = v * v
+				return tmp
+			}
+			alloc 16 :bump {
+				i = 0
+				total = 0
+				while i < 100 {
+					x = bumpSquare(i)
+					total = total + x
+					i = i + 1
+				}
+				print(total)
+			}
+			`,
+			Output: "328350\n",
+		}
+	},
+	"alloc-bump-free-rejected": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 :bump {
+				x = 1
+				free(x)
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "cannot free 'x' in a bump arena",
+			},
+		}
+	},
+	"alloc-bump-free-in-function": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			fn scratch() {
+				a = 1
+				b = 2
+				free(a)
+			}
+			alloc 16 :bump {
+				scratch()
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "bump allocator can only free its most recent allocation",
+			},
+		}
+	},
+	"alloc-pool-reuses-slots": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 :pool(4) {
+				a = 1
+				b = 2
+				free(a)
+				c = 3
+				print(b, c)
+			}
+			`,
+			Output: "2 3\n",
+		}
+	},
+	"alloc-pool-value-too-large": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 :pool(4) {
+				x = 1l
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "pool slot size is 4 bytes, need 8",
+			},
+		}
+	},
+	"alloc-unknown-strategy": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 :heap {
+				x = 1
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "unknown allocator strategy 'heap'",
+			},
+		}
+	},
+	"alloc-nested-uses-outer-variables": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				total = 0
+				name = "a"
+				i = 0
+				while i < 3 {
+					alloc 64 :bump {
+						scratch: long = 10
+						total = total + i + int(scratch)
+						name = name + "b"
+					}
+					i = i + 1
+				}
+				after = 7
+				print(total, name, after)
+			}
+			`,
+			Output: "33 abbb 7\n",
+		}
+	},
+	"alloc-nested-frees-outer-variable": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				x = 1
+				alloc 8 {
+					y = x + 1
+					free(x)
+					print(y)
+				}
+				x = 5l
+				print(x)
+			}
+			`,
+			Output: "2\n5\n",
+		}
+	},
+	"alloc-nested-locals-out-of-scope": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				alloc 8 {
+					inner = 1
+				}
+				print(inner)
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "undefined variable 'inner'",
+			},
+		}
+	},
+	"alloc-nested-break-rejected": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				while true {
+					alloc 8 {
+						break
+					}
+				}
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "'break' cannot leave an alloc block at line 5",
+			},
+		}
+	},
+	"alloc-size-from-native": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc answer() / 5 {
+				x = 1l
+				print(x)
+			}
+			`,
+			Output: "1\n",
+		}
+	},
+	"alloc-size-from-outer-variable": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				n = 2
+				alloc n * 4 {
+					a = 1
+					b = 2
+					print(a + b)
+				}
+			}
+			`,
+			Output: "3\n",
+		}
+	},
+	"alloc-size-from-identifier": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				n = 8
+				alloc n {
+					a = 1
+					b = 2
+					print(a + b)
+				}
+			}
+			`,
+			Output: "3\n",
+		}
+	},
+	"alloc-size-too-small-at-runtime": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				n = 1
+				alloc n * 4 {
+					a = 1l
+				}
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "out of memory: need 8 bytes, have 4 free",
+			},
+		}
+	},
+	"alloc-size-must-be-integer": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 1.5 {
+				x = 1
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "alloc size must be an integer, got decimal",
+			},
+		}
+	},
+	"alloc-size-negative": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 0 - 8 {
+				x = 1
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "alloc size must not be negative, got -8",
+			},
+		}
+	},
+	"alloc-size-over-vm-limit": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 40000 {
+				alloc 40000 {
+					x = 1
+				}
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "alloc size 40000 exceeds the limit of 65536 bytes (40000 in use by enclosing blocks)",
+			},
+		}
+	},
+	"alloc-grow-bump": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 4 grow 64 :bump {
+				x = 5
+				y = x
+				s = "hello"
+				z = 1l
+				buf: int[4]
+				buf[3] = y + 1
+				print(x, y, s, z, buf[3])
+			}
+			`,
+			Output:  "5 5 hello 1 6\n",
+			Growths: []int{8, 17, 34, 64},
+		}
+	},
+	"alloc-grow-freelist-keeps-strings": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 grow 256 {
+				a = "abc"
+				b = a + "def"
+				c = b + b
+				print(a, b, c)
+			}
+			`,
+			Output:  "abc abcdef abcdefabcdef\n",
+			Growths: []int{18, 36},
+		}
+	},
+	"alloc-grow-ceiling-from-identifier": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				ceiling = 16
+				alloc 4 grow ceiling {
+					a = 1
+					b = 2
+					print(a + b)
+				}
+			}
+			`,
+			Output:  "3\n",
+			Growths: []int{8},
+		}
+	},
+	"alloc-grow-ceiling-reached": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 4 grow 8 {
+				a = 1
+				b = 2
+				c = 3
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "out of memory: need 4 bytes, have 0 free; the block is at its grow ceiling of 8 bytes",
+			},
+		}
+	},
+	"alloc-grow-ceiling-below-size": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 grow 8 {
+				a = 1
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "grow ceiling 8 is smaller than the alloc size 16",
+			},
+		}
+	},
+	"alloc-grow-ceiling-must-be-integer": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 grow 2.5 {
+				a = 1
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "grow ceiling must be an integer, got decimal",
+			},
+		}
+	},
+	"alloc-compact-on-fragmentation": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				a = 1
+				b = 2
+				c = 3
+				d = 4
+				free(a)
+				free(c)
+				e = 5l
+				print(b, d, e)
+			}
+			`,
+			Output: "2 4 5\n",
+		}
+	},
+	"alloc-compact-moves-stack-values": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			fn widen(x: int, y: long): long {
+				return y + 1l
+			}
+			alloc 24 {
+				a = 1l
+				b = 2l
+				c = 3
+				free(a)
+				print(widen(c, b), b, c)
+			}
+			`,
+			Output: "3 2 3\n",
+		}
+	},
+	"alloc-compact-intrinsic": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				a = 1
+				b = 2
+				c = 3
+				d = 4
+				free(a)
+				free(c)
+				n = compact()
+				print(b, d, n, compact())
+			}
+			`,
+			Output: "2 4 8 0\n",
+		}
+	},
+	"alloc-compact-bump-reclaims-outgrown-string": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 24 :bump {
+				s = "ab"
+				s = "abcdefgh"
+				n = compact()
+				y = 1l
+				print(s, n, y)
+			}
+			`,
+			Output: "abcdefgh 12 1\n",
+		}
+	},
+	"alloc-compact-refused-by-alias": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				a = 1
+				b = 2
+				p = *int(4)
+				c = 3
+				free(a)
+				n = compact()
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "instr 'OpArenaCOMPACT': pointer alias at offset 4 views a region that would move",
+			},
+		}
+	},
+	"alloc-compact-auto-refused-by-alias": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 12 {
+				a = 1
+				b = 2
+				p = *int(4)
+				c = 3
+				free(a)
+				free(c)
+				e = 5l
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "out of memory: need 8 bytes, have 8 free (not compacted: pointer alias at offset 4 views a region that would move)",
+			},
+		}
+	},
+	"alloc-compact-expects-no-arguments": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				n = compact(1)
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "compact expects 0 arguments, got 1",
+			},
+		}
+	},
+	"alloc-auto-peak": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			fn autoNext(n: int): int {
+				k = n + 1
+				return k
+			}
+			alloc auto {
+				i = 0
+				while i < 3 {
+					t = 1l
+					a: int[2]
+					i = i + 1
+				}
+				s = "hi"
+				s = "hello"
+				u = s
+				z = autoNext(i)
+				print(u, z)
+			}
+			`,
+			Output: "hello 4\n",
+			Disasm: "STACK_ALLOC auto=32",
+		}
+	},
+	"alloc-auto-free-reuses-memory": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc auto {
+				a = 1l
+				free(a)
+				b = 2l
+				print(b)
+			}
+			`,
+			Output: "2\n",
+			Disasm: "STACK_ALLOC auto=8",
+		}
+	},
+	"alloc-auto-bump-keeps-outgrown-strings": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc auto :bump {
+				s = "ab"
+				s = "abcd"
+				x = 1
+				print(s, x)
+			}
+			`,
+			Output: "abcd 1\n",
+			Disasm: "STACK_ALLOC bump auto=18",
+		}
+	},
+	"alloc-auto-pool-counts-slots": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc auto :pool(8) {
+				a = 1
+				b = 2l
+				free(a)
+				c = 3
+				print(b, c)
+			}
+			`,
+			Output: "2 3\n",
+			Disasm: "STACK_ALLOC pool=8 auto=16",
+		}
+	},
+	"alloc-auto-nested": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc auto grow 64 {
+				alloc auto {
+					x = 1l
+					print(x)
+				}
+				y = 1
+			}
+			`,
+			Output: "1\n",
+			Disasm: "STACK_ALLOC auto=4 grow",
+		}
+	},
+	"alloc-auto-variable-named-auto": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 {
+				auto = 2
+				alloc auto * 4 {
+					x = 1l
+					print(x)
+				}
+			}
+			`,
+			Output: "1\n",
+		}
+	},
+	"alloc-auto-runtime-string": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc auto {
+				s = "a"
+				t = s + "b"
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "alloc auto: cannot size the string stored at line 4; its length is only known at runtime",
+			},
+		}
+	},
+	"alloc-auto-recursion": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			fn autoFact(n: int): int {
+				if n < 2 { return 1 }
+				return n * autoFact(n - 1)
+			}
+			alloc auto {
+				x = autoFact(5)
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "alloc auto: cannot size the recursive call to 'autoFact' at line 4",
+			},
+		}
+	},
+	"alloc-auto-pool-slot-too-small": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc auto :pool(4) {
+				a = 1
+				b = 2l
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "alloc auto: pool slot size is 4 bytes, need 8 at line 4",
+			},
+		}
+	},
+	"alloc-auto-over-limit": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc auto {
+				n = 1
+				buf: long[1000000000]
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "alloc auto: the allocation at line 4 needs 8000000004 bytes, more than the limit of 67108864 bytes",
+			},
+		}
+	},
+	"sanitize-alias-into-live-slot": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				a = 1
+				b = 2
+				p = *int(4)
+				p = 5
+				print(a, b, p)
+			}
+			`,
+			Sanitize: true,
+			Output:   "1 5 5\n",
+		}
+	},
+	"sanitize-alias-load-after-free": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				a = 1
+				b = 2
+				p = *int(0)
+				print(p)
+				free(a)
+				print(p)
+			}
+			`,
+			Sanitize: true,
+			Warnings: []string{"line 8: alias 'p' loads freed memory of 'a'; it is freed at line 7"},
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "line 8: instr 'OpVarLOAD': sanitize: alias slot 2 loads freed byte at offset 0 of slot 0",
+			},
+		}
+	},
+	"sanitize-alias-load-unowned": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				a = 1
+				p = *int(8)
+				print(p)
+			}
+			`,
+			Sanitize: true,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "line 5: instr 'OpVarLOAD': sanitize: alias slot 1 loads unowned byte at offset 8",
+			},
+		}
+	},
+	"sanitize-alias-store-across-slots": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				a = 1
+				b = 2
+				p = *int(2)
+				p = 7
+			}
+			`,
+			Sanitize: true,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "line 6: instr 'OpVarSTORE': sanitize: alias slot 2 stores across slot 0 and slot 1 at offset 2",
+			},
+		}
+	},
+	"sanitize-follows-compaction": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				a = 1
+				b = 2
+				free(a)
+				n = compact()
+				p = *int(0)
+				print(p, n)
+			}
+			`,
+			Sanitize: true,
+			Output:   "2 4\n",
+		}
+	},
+	"sanitize-off-reads-freed-memory": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				a = 1
+				p = *int(0)
+				free(a)
+				print(p)
+			}
+			`,
+			Output:   "0\n",
+			Warnings: []string{"line 6: alias 'p' loads freed memory of 'a'; it is freed at line 5"},
+		}
+	},
+	"leak-check-warns": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				a = 1
+				b = 2l
+				s = "hi"
+				p = *int(0)
+				free(a)
+				print(b)
+			}
+			`,
+			Leaks:  true,
+			Output: "2\n",
+			Stderr: "warning: line 2: alloc block exits with 2 leaked slots: 'b' (8 bytes, allocated at line 4), 's' (6 bytes, allocated at line 5)\n",
+		}
+	},
+	"leak-check-clean-block": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			fn leakFree(n: int): int {
+				k = n * 2
+				return k
+			}
+			alloc 32 {
+				a = leakFree(2)
+				if a > 1 {
+					t = 1
+				}
+				print(a)
+				free(a)
+			}
+			`,
+			Leaks:  true,
+			Output: "4\n",
+		}
+	},
+	"leak-check-nested-block": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				a = 1
+				alloc 16 {
+					pt = (1, 2)
+				}
+				free(a)
+			}
+			`,
+			Leaks:  true,
+			Stderr: "warning: line 4: alloc block exits with 1 leaked slots: 'pt' (8 bytes, allocated at line 5)\n",
+		}
+	},
+	"leak-check-strict": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				buf: int[2]
+			}
+			`,
+			Leaks:  true,
+			Strict: true,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "line 2: instr 'OpStackFREE': alloc block exits with 1 leaked slots: 'buf' (8 bytes, allocated at line 3)",
+			},
+		}
+	},
+	"lifetime-free-in-loop-condition": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				x = 3
+				while x > 0 {
+					free(x)
+				}
+			}
+			`,
+			Warnings: []string{
+				"line 3: possible leak of 'x'; it is still allocated when the block exits on the paths that skip the free at line 5",
+				"line 4: possible use after free of 'x'; it is freed at line 5",
+				"line 5: possible double free of 'x'; it is freed at line 5",
+			},
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "line 4: instr 'OpVarLOAD': use after free on slot 0",
+			},
+		}
+	},
+	"lifetime-free-in-loop-body": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				x = 3
+				i = 0
+				while i < 2 {
+					free(x)
+					i = i + 1
+				}
+			}
+			`,
+			Warnings: []string{
+				"line 3: possible leak of 'x'; it is still allocated when the block exits on the paths that skip the free at line 6",
+				"line 6: possible double free of 'x'; it is freed at line 6",
+			},
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "line 6: instr 'OpVarFREE': double free on slot 0",
+			},
+		}
+	},
+	"lifetime-conditional-free-in-loop": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				i = 0
+				while i < 3 {
+					y = i
+					if i == 1 {
+						free(y)
+					}
+					i = i + 1
+				}
+				print(i)
+			}
+			`,
+			// The free at the end of every pass skips y where it was freed
+			Output: "3\n",
+		}
+	},
+	"lifetime-use-after-free-in-branch": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				x = 1
+				if answer() < 40 {
+					free(x)
+				}
+				print(x)
+			}
+			`,
+			Output: "1\n",
+			Warnings: []string{
+				"line 3: possible leak of 'x'; it is still allocated when the block exits on the paths that skip the free at line 5",
+				"line 7: possible use after free of 'x'; it is freed at line 5",
+			},
+		}
+	},
+	"lifetime-freed-in-both-branches": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				x = 1
+				if answer() > 40 {
+					free(x)
+				} else {
+					free(x)
+				}
+				print(x)
+				free(x)
+			}
+			`,
+			Warnings: []string{
+				"line 9: use after free of 'x'; it is freed at line 5",
+				"line 10: double free of 'x'; it is freed at line 5",
+			},
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "line 9: instr 'OpVarLOAD': use after free on slot 0",
+			},
+		}
+	},
+	"lifetime-freed-on-some-paths": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				x = 1
+				if answer() > 40 {
+					free(x)
+				}
+			}
+			`,
+			Warnings: []string{"line 3: possible leak of 'x'; it is still allocated when the block exits on the paths that skip the free at line 5"},
+		}
+	},
+	"lifetime-in-function": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			fn drain(n: int) {
+				while n > 0 {
+					free(n)
+				}
+			}
+			alloc 16 {
+				drain(0)
+			}
+			`,
+			Warnings: []string{
+				"line 3: possible use after free of 'n'; it is freed at line 4",
+				"line 4: possible double free of 'n'; it is freed at line 4",
+			},
+		}
+	},
+	"lifetime-clean-loop": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				i = 0
+				while i < 3 {
+					t = i * 2
+					s = "v"
+					free(t)
+					i = i + 1
+				}
+				p = *int(0)
+				print(p)
+			}
+			`,
+			Output: "3\n",
+		}
+	},
+	"lifetime-strict-fails": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				a = 1
+				p = *int(0)
+				free(a)
+				print(p)
+			}
+			`,
+			Strict: true,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "lifetime check failed: line 6: alias 'p' loads freed memory of 'a'; it is freed at line 5",
+			},
+		}
+	},
+	"lifetime-strict-warns-on-possible": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			fn drainAll(n: int) {
+				while n > 0 {
+					free(n)
+				}
+			}
+			alloc 16 {
+				drainAll(0)
+			}
+			`,
+			Strict: true,
+			Warnings: []string{
+				"line 3: possible use after free of 'n'; it is freed at line 4",
+				"line 4: possible double free of 'n'; it is freed at line 4",
+			},
+		}
+	},
+	"lifetime-alias-block-over-limit": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 64 {
+				buf: long[1000000000]
+				p = *int(0)
+				print(p)
+			}
+			`,
+			Warnings: []string{"line 2: the allocation at line 3 needs 8000000000 bytes, more than the limit of 67108864 bytes; the aliases of the block are not checked"},
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "instr 'OpArrayALLOC': out of memory: need 8000000000 bytes",
+			},
+		}
+	},
+	"lifetime-large-block-without-aliases": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 64 {
+				buf: long[1000000000]
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "runtime",
+				Message: "instr 'OpArrayALLOC': out of memory: need 8000000000 bytes",
+			},
+		}
+	},
+	"lifetime-alias-in-loop": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				a = 1
+				p = *int(0)
+				i = 0
+				while i < 2 {
+					print(p)
+					if i == 0 {
+						free(a)
+					}
+					i = i + 1
+				}
+			}
+			`,
+			Output: "1\n0\n",
+			Warnings: []string{
+				"line 3: possible leak of 'a'; it is still allocated when the block exits on the paths that skip the free at line 9",
+				"line 7: possible alias 'p' loads freed memory of 'a'; it is freed at line 9",
+				"line 9: possible double free of 'a'; it is freed at line 9",
+			},
+		}
+	},
+	"atomic-commits": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				a = 1
+				atomic {
+					a = 2
+					b = 3
+					a = a + b
+				}
+				print(a)
+			}
+			`,
+			Output: "5\n",
+			Disasm: "ATOMIC_BEGIN addr=",
+		}
+	},
+	"atomic-rolls-back-on-error": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 64 {
+				a = 1
+				s = "old"
+				zero = 0
+				atomic {
+					a = 5
+					s = "a longer string"
+					pt = (1, 2)
+					q = a / zero
+				}
+				print(a, s)
+				t = "next"
+				print(t)
+			}
+			`,
+			Output: "1 old\nnext\n",
+			Stderr: "warning: line 6: atomic block rolled back: line 10: instr 'OpArithDIV': integer division by zero\n",
+		}
+	},
+	"atomic-else-after-failed-call": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			fn atomicRatio(n: int): int {
+				k = 10
+				return k / n
+			}
+			alloc 32 {
+				a = 1
+				atomic {
+					a = 7
+					alloc 16 {
+						x = atomicRatio(0)
+					}
+				} else {
+					print("failed", a)
+				}
+				print(atomicRatio(5), a)
+			}
+			`,
+			Output: "failed 1\n2 1\n",
+		}
+	},
+	"atomic-nested-inner-rollback": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 32 {
+				a = 1
+				b = 1
+				zero = 0
+				atomic {
+					a = 2
+					atomic {
+						b = 2
+						c = b / zero
+					} else {
+						print("inner")
+					}
+				}
+				print(a, b)
+			}
+			`,
+			Output: "inner\n2 1\n",
+		}
+	},
+	"atomic-rollback-shrinks-grown-arena": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 8 grow 64 {
+				a = 1
+				zero = 0
+				atomic {
+					b = 2l
+					c = 3l
+					d = a / zero
+				} else {
+					e = 4
+					print(a, e)
+				}
+			}
+			`,
+			Output: "1 4\n",
+			// Rolled back to 8 bytes, so the else block grows it again
+			Growths: []int{16, 32, 16},
+		}
+	},
+	"atomic-variable-name": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				atomic = 3
+				print(atomic)
+			}
+			`,
+			Output: "3\n",
+		}
+	},
+	"atomic-outside-alloc": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			atomic {
+				print("x")
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "atomic block outside alloc block",
+			},
+		}
+	},
+	"atomic-break-cannot-leave": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				i = 0
+				while i < 3 {
+					atomic {
+						break
+					}
+				}
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "'break' cannot leave an atomic block at line 6",
+			},
+		}
+	},
+	"atomic-return-cannot-leave": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			fn atomicEarly(n: int): int {
+				atomic {
+					return n
+				}
+				return 0
+			}
+			`,
+			Error: &TestCompilerError{
+				Phase:   "compile",
+				Message: "'return' cannot leave an atomic block at line 4",
+			},
+		}
+	},
+	"persistent-arena-restores-variables": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 64 from "/state/counter.arena" {
+				count: int
+				name: string
+				hist: byte[2]
+				count = count + 1
+				if count == 1 {
+					name = "first"
+				}
+				hist[count % 2] = hist[count % 2] + byte(1)
+				print(count, name, hist[0], hist[1])
+			}
+			alloc 64 from "/state/counter.arena" {
+				count: int
+				name: string
+				hist: byte[2]
+				count = count + 1
+				hist[count % 2] = hist[count % 2] + byte(1)
+				print(count, name, hist[0], hist[1])
+			}
+			`,
+			Output: "1 first 0 1\n2 first 1 1\n",
+			Disasm: `STACK_ALLOC from="/state/counter.arena" layout=`,
+		}
+	},
+	"persistent-arena-nested-in-loop": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				i = 0
+				while i < 3 {
+					alloc 8 grow 64 from "/state/runs.arena" :bump {
+						runs: long
+						runs = runs + 1
+						print(runs)
+					}
+					i = i + 1
+				}
+			}
+			`,
+			Output: "1\n2\n3\n",
+		}
+	},
+	"persistent-arena-declared-string-starts-empty": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				i = 0
+				while i < 3 {
+					alloc 64 from "/state/names.arena" {
+						name: string
+						name = name + "a"
+						print(name)
+					}
+					i = i + 1
+				}
+			}
+			`,
+			Output: "a\naa\naaa\n",
+			Disasm: "STR_ALLOC slot=1 declared",
+		}
+	},
+	"persistent-arena-auto-counts-declared-strings": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc auto :bump from "/state/empty.arena" {
+				name: string
+				print(name + "!")
+			}
+			`,
+			Output: "!\n",
+			Disasm: `STACK_ALLOC bump auto=4 from="/state/empty.arena"`,
+		}
+	},
+	"persistent-arena-modifiers-in-either-order": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 :bump from "/state/order.arena" {
+				runs: int
+				runs = runs + 1
+			}
+			alloc 16 from "/state/order.arena" :bump {
+				runs: int
+				runs = runs + 1
+				print(runs)
+			}
+			`,
+			Output: "2\n",
+		}
+	},
+	"persistent-arena-duplicate-modifier": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 from "/state/a.arena" from "/state/b.arena" {
+				x = 1
+			}
+			`,
+			Error: &TestCompilerError{Phase: "parse", Message: "alloc statement has more than one 'from'"},
+		}
+	},
+	"persistent-arena-is-no-leak": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 from "/state/kept.arena" {
+				kept = 42
+			}
+			`,
+			Leaks: true,
+		}
+	},
+	"persistent-arena-layout-mismatch": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 64 from "/state/layout.arena" {
+				count: int
+			}
+			alloc 64 from "/state/layout.arena" {
+				count: long
+			}
+			`,
+			Error: &TestCompilerError{Phase: "runtime", Message: "persistent arena '/state/layout.arena' was saved with layout"},
+		}
+	},
+	"persistent-arena-strategy-mismatch": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 64 from "/state/strategy.arena" {
+				count: int
+			}
+			alloc 64 from "/state/strategy.arena" :bump {
+				count: int
+			}
+			`,
+			Error: &TestCompilerError{Phase: "runtime", Message: "its variables, their types or the allocator changed"},
+		}
+	},
+	"persistent-arena-expects-path": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 64 from state {
+			}
+			`,
+			Error: &TestCompilerError{Phase: "parse", Message: "expected path string after 'from'"},
+		}
+	},
+	"persistent-arena-empty-path": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 64 from "" {
+			}
+			`,
+			Error: &TestCompilerError{Phase: "compile", Message: "persistent arena path must not be empty"},
+		}
+	},
+	"atomic-rollback-keeps-views-rebased": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 100 {
+				zero = 0
+				atomic { w = 1 / zero }
+				big: byte[76]
+				p = 1
+				q = 2
+				r = 3
+				c: long = 42l
+				free(p)
+				free(r)
+				y = c
+				print(y)
+			}
+			`,
+			Output: "42\n",
+			Stderr: "warning: line 4: atomic block rolled back: line 4: instr 'OpArithDIV': integer division by zero\n",
+		}
+	},
+	"alloc-auto-continue-keeps-locals-live": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc auto {
+				i = 0
+				while i < 3 {
+					a: long = 1l
+					if i == 5 {
+						continue
+					}
+					b: long = 2l
+					i = i + 1
+				}
+				print(i)
+			}
+			`,
+			Output: "3\n",
+			Disasm: "STACK_ALLOC auto=20",
+		}
+	},
+	"alloc-auto-break-keeps-locals-live": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc auto {
+				i = 0
+				while true {
+					a: long = 1l
+					if i == 2 {
+						break
+					}
+					b: long = 2l
+					i = i + 1
+				}
+				print(i)
+			}
+			`,
+			Output: "2\n",
+			Disasm: "VAR_FREE slot=1 scoped early",
+		}
+	},
+	"alloc-bump-block-exit-keeps-outgrown-locals": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 64 :bump {
+				if true {
+					s = "a"
+					t = 1
+					s = "abcdef"
+					print(s, t)
+				}
+				u = 2
+				print(u)
+			}
+			`,
+			Output: "abcdef 1\n2\n",
+			Disasm: "VAR_FREE slot=0 scoped",
+		}
+	},
+	"persistent-arena-restored-then-grown": func() *TestCompilerCase {
+		return &TestCompilerCase{
+			Source: `
+			alloc 16 {
+				i = 0
+				while i < 2 {
+					alloc 100 grow 200 from "/state/views.arena" {
+						big: byte[80]
+						if true {
+							p = 1
+							q = 2
+							r = 3
+							c: long = 42l
+							free(p)
+							free(r)
+							y = c
+							if i == 1 {
+								more: byte[40]
+								print(y, c)
+							}
+						}
+					}
+					i = i + 1
+				}
+			}
+			`,
+			Output:  "42 42\n",
+			Growths: []int{200},
+		}
+	},
 }
 
 func TestCompilerCases(t *testing.T) {
 	p := parser.NewParser()
 	c := compiler.NewCompiler()
 
+	// Register natives from Go code — one returning a single value, one returning two.
+	vm.RegisterNative("answer", func(nat *vm.Native, args []value.Value) ([]value.Value, error) {
+		v, err := value.FromInt64(value.TagInteger, 42)
+		return []value.Value{v}, err
+	}, value.TagInteger)
+	vm.RegisterNative("pair", func(nat *vm.Native, args []value.Value) ([]value.Value, error) {
+		return []value.Value{value.FromBool(true), value.FromBool(false)}, nil
+	}, value.TagBoolean, value.TagBoolean)
+
+	// Record the capacity after every arena growth of the current case
+	var growths []int
+	onGrowth := func(g vm.ArenaGrowth) {
+		growths = append(growths, g.To)
+	}
+
 	vm, err := vm.NewEphemeralVM()
 	if err != nil {
 		t.Fatalf("Failed to create ephemeral vm: %v", err)
 	}
+	// A small limit lets the cases hit it without allocating much
+	vm.MaxAllocSize(64 << 10)
+	vm.OnArenaGrowth(onGrowth)
 
 	// Register a stencil from Go code — available to all tests without a `struct` declaration in the script source.
 	if err := c.RegisterStencil("gorecord", compiler.Field("id", value.TagInteger), compiler.Field("active", value.TagBoolean)); err != nil {
 		t.Fatalf("Failed to register stencil: %v", err)
 	}
+	if err := c.RegisterStencil("gonested", compiler.Embed("rec", c.LookupStencil("gorecord")), compiler.Field("count", value.TagByte)); err != nil {
+		t.Fatalf("Failed to register nested stencil: %v", err)
+	}
 
 	for name, factory := range CaseFactories {
 		t.Run(name, func(t *testing.T) {
@@ -633,6 +3605,7 @@ func TestCompilerCases(t *testing.T) {
 				}
 			}
 
+			c.SetStrict(test.Strict)
 			byteCode, err := c.Compile(ast)
 			if test.Error != nil && test.Error.Phase == "compile" {
 				if err == nil {
@@ -648,6 +3621,25 @@ func TestCompilerCases(t *testing.T) {
 				}
 			}
 
+			var warnings []string
+			for _, d := range byteCode.Diagnostics {
+				warnings = append(warnings, d.String())
+			}
+			if !slices.Equal(warnings, test.Warnings) {
+				t.Fatalf("Warnings = %q, want %q", warnings, test.Warnings)
+			}
+
+			if test.Disasm != "" && !strings.Contains(byteCode.Disassemble(), test.Disasm) {
+				t.Fatalf("Disassembly does not contain %q:\n%s", test.Disasm, byteCode.Disassemble())
+			}
+
+			var stdout, stderr bytes.Buffer
+			vm.Stdout(&stdout)
+			vm.Stderr(&stderr)
+			vm.SetSanitize(test.Sanitize)
+			vm.SetLeakCheck(test.Leaks)
+			growths = nil
+
 			_, err = vm.Run(ctx, byteCode)
 			if test.Error != nil && test.Error.Phase == "runtime" {
 				if err == nil {
@@ -662,6 +3654,16 @@ func TestCompilerCases(t *testing.T) {
 					t.Fatalf("Failed to run bytecode in virtual machine: %v", err)
 				}
 			}
+
+			if test.Output != "" && stdout.String() != test.Output {
+				t.Fatalf("Output = %q, want %q", stdout.String(), test.Output)
+			}
+			if (test.Stderr != "" || test.Leaks) && stderr.String() != test.Stderr {
+				t.Fatalf("Stderr = %q, want %q", stderr.String(), test.Stderr)
+			}
+			if len(test.Growths) > 0 && !slices.Equal(growths, test.Growths) {
+				t.Fatalf("Arena growths = %v, want %v", growths, test.Growths)
+			}
 		})
 	}
 }
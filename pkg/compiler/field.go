@@ -0,0 +1,232 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/mwantia/vega/pkg/parser"
+	"github.com/mwantia/vega/pkg/value"
+)
+
+// lookupField resolves 'obj.field' or 'obj.0' to the struct or tuple symbol
+// and the layout of the addressed field. Chained access into nested structs
+// ('e.pos.x') is flattened: the returned Offset is relative to the start of
+// the slot.
+func (c *Compiler) lookupField(e *parser.AttributeExpression) (SymbolInfo, FieldLayout, error) {
+	fieldName := e.Attribute.Value
+
+	if parent, ok := e.Object.(*parser.AttributeExpression); ok {
+		info, outer, err := c.lookupField(parent)
+		if err != nil {
+			return SymbolInfo{}, FieldLayout{}, err
+		}
+		if outer.Stencil == nil {
+			return SymbolInfo{}, FieldLayout{}, fmt.Errorf("field '%s' is not a struct", fieldPath(parent))
+		}
+		field, ok := outer.Stencil.LookupField(fieldName)
+		if !ok {
+			return SymbolInfo{}, FieldLayout{}, fmt.Errorf("struct '%s' has no field '%s'", outer.Stencil.Name, fieldName)
+		}
+		field.Offset += outer.Offset
+		return info, field, nil
+	}
+
+	ident, ok := e.Object.(*parser.IdentifierExpression)
+	if !ok {
+		return SymbolInfo{}, FieldLayout{}, fmt.Errorf("field access requires an identifier, got %T", e.Object)
+	}
+	if c.scope == nil {
+		return SymbolInfo{}, FieldLayout{}, fmt.Errorf("identifier '%s' outside alloc block", ident.Value)
+	}
+	info, exists := c.scope.Lookup(ident.Value)
+	if !exists {
+		return SymbolInfo{}, FieldLayout{}, fmt.Errorf("undefined variable '%s'", ident.Value)
+	}
+	if info.Stencil == nil {
+		return SymbolInfo{}, FieldLayout{}, fmt.Errorf("variable '%s' is not a struct or tuple", ident.Value)
+	}
+	field, ok := info.Stencil.LookupField(fieldName)
+	if !ok && info.Stencil.Name == "" {
+		return SymbolInfo{}, FieldLayout{}, fmt.Errorf("tuple '%s' has no field '%s'", ident.Value, fieldName)
+	}
+	if !ok {
+		return SymbolInfo{}, FieldLayout{}, fmt.Errorf("struct '%s' has no field '%s'", info.Stencil.Name, fieldName)
+	}
+	return info, field, nil
+}
+
+// lookupPrimitiveField is lookupField for loads and stores of a single value,
+// which cannot address a nested struct as a whole.
+func (c *Compiler) lookupPrimitiveField(e *parser.AttributeExpression) (SymbolInfo, FieldLayout, error) {
+	info, field, err := c.lookupField(e)
+	if err != nil {
+		return info, field, err
+	}
+	if field.Stencil != nil {
+		return info, field, fmt.Errorf("field '%s' is a struct '%s'; access one of its fields", fieldPath(e), field.Stencil.Name)
+	}
+	return info, field, nil
+}
+
+// fieldPath renders an attribute chain as written, e.g. 'e.pos.x'.
+func fieldPath(e *parser.AttributeExpression) string {
+	if parent, ok := e.Object.(*parser.AttributeExpression); ok {
+		return fieldPath(parent) + "." + e.Attribute.Value
+	}
+	return e.Object.String() + "." + e.Attribute.Value
+}
+
+// compileFieldAssignment compiles 'p.x = v' into a single OpFieldSTORE. The
+// offset and tag come from the stencil, so the value must have exactly the
+// field's type. A nested struct field can be assigned a literal of its struct,
+// which stores each of its fields.
+func (c *Compiler) compileFieldAssignment(b *ByteCode, s *parser.FieldAssignmentStatement) error {
+	if c.scope == nil {
+		return fmt.Errorf("assignment outside alloc block")
+	}
+	info, field, err := c.lookupField(s.Left)
+	if err != nil {
+		return err
+	}
+	target := fieldPath(s.Left)
+
+	if field.Stencil != nil {
+		literal, ok := s.Value.(*parser.StructExpression)
+		if !ok || literal.Name != field.Stencil.Name {
+			return fmt.Errorf("field '%s' is a struct '%s'; assign a '%s' literal or one of its fields", target, field.Stencil.Name, field.Stencil.Name)
+		}
+		return c.compileStencilLiteral(b, info.SlotID, field.Offset, field.Stencil, literal, s.Position().Line)
+	}
+
+	rhs, err := coerceLiteral(s.Value, value.MaskForTag(field.Tag))
+	if err != nil {
+		return fmt.Errorf("value for field '%s': %v", target, err)
+	}
+	tag, err := c.inferTypeTag(rhs)
+	if err != nil {
+		return fmt.Errorf("cannot infer type for field '%s': %v", target, err)
+	}
+	if tag != field.Tag {
+		want, _ := value.NameForTag(field.Tag)
+		got, _ := value.NameForTag(tag)
+		return fmt.Errorf("type mismatch: field '%s' holds %s, got %s", target, want, value.NameOrUnknown(got))
+	}
+
+	if err := c.compileExpression(b, rhs); err != nil {
+		return fmt.Errorf("failed to compile field value: %v", err)
+	}
+	b.EmitField(OpFieldSTORE, info.SlotID, field.Offset, byte(field.Tag), s.Position().Line)
+	return nil
+}
+
+// compileStencilLiteral stores every field of a struct literal into the slot,
+// starting at the byte offset base. Nested struct literals recurse with the
+// offset of their field.
+func (c *Compiler) compileStencilLiteral(b *ByteCode, slotID, base int, stencil *Stencil, literal *parser.StructExpression, line int) error {
+	for _, fieldName := range literal.Order {
+		fieldExpr := literal.Fields[fieldName]
+		field, ok := stencil.LookupField(fieldName)
+		if !ok {
+			return fmt.Errorf("struct '%s' has no field '%s'", literal.Name, fieldName)
+		}
+
+		if field.Stencil != nil {
+			nested, ok := fieldExpr.(*parser.StructExpression)
+			if !ok || nested.Name != field.Stencil.Name {
+				return fmt.Errorf("struct field '%s' expects a '%s' literal, got %s", fieldName, field.Stencil.Name, fieldExpr.String())
+			}
+			if err := c.compileStencilLiteral(b, slotID, base+field.Offset, field.Stencil, nested, line); err != nil {
+				return err
+			}
+			continue
+		}
+
+		fieldExpr, err := coerceLiteral(fieldExpr, value.MaskForTag(field.Tag))
+		if err != nil {
+			return fmt.Errorf("struct field '%s': %v", fieldName, err)
+		}
+		if err := c.compileExpression(b, fieldExpr); err != nil {
+			return fmt.Errorf("failed to compile struct field '%s': %v", fieldName, err)
+		}
+		b.EmitField(OpFieldSTORE, slotID, base+field.Offset, byte(field.Tag), line)
+	}
+	return nil
+}
+
+// lookupStencilSymbol resolves an identifier to a struct or tuple symbol.
+func (c *Compiler) lookupStencilSymbol(expr parser.Expression) (SymbolInfo, bool) {
+	ident, ok := expr.(*parser.IdentifierExpression)
+	if !ok || c.scope == nil {
+		return SymbolInfo{}, false
+	}
+	info, exists := c.scope.Lookup(ident.Value)
+	if !exists || info.Stencil == nil {
+		return SymbolInfo{}, false
+	}
+	return info, true
+}
+
+// describeStencil names the layout of a stencil symbol for error messages.
+func describeStencil(stencil *Stencil) string {
+	if stencil.Name == "" {
+		return "tuple"
+	}
+	return "struct '" + stencil.Name + "'"
+}
+
+// compileStencilCopy compiles 'q = p' where p is a struct or tuple. A new q
+// gets its own stencil slot; an existing q must have the same layout. The
+// whole slot is copied with one OpStencilCOPY.
+func (c *Compiler) compileStencilCopy(b *ByteCode, s *parser.AssignmentStatement, src SymbolInfo) error {
+	name := s.Name.Value
+	line := s.Position().Line
+	if len(s.Constraints) > 0 {
+		return fmt.Errorf("type constraint for '%s': cannot constrain a copy of %s", name, describeStencil(src.Stencil))
+	}
+
+	info, exists := c.scope.Lookup(name)
+	if !exists {
+		info = c.scope.Define(name, 0, 0)
+		info.Stencil = src.Stencil
+		c.scope.Update(name, info)
+		b.Symbol(b.EmitField(OpStencilALLOC, info.SlotID, src.Stencil.TotalSize, 0, line), name)
+	} else if info.Stencil == nil {
+		want, _ := value.NameForTag(info.Tag)
+		return fmt.Errorf("type mismatch: '%s' holds %s, got %s", name, value.NameOrUnknown(want), describeStencil(src.Stencil))
+	} else if !info.Stencil.sameLayout(src.Stencil) {
+		return fmt.Errorf("type mismatch: '%s' holds %s, got %s", name, describeStencil(info.Stencil), describeStencil(src.Stencil))
+	}
+
+	// Emit block copy: Argument=destination slot, Offset=source slot
+	b.EmitField(OpStencilCOPY, info.SlotID, src.SlotID, 0, line)
+	return nil
+}
+
+// inferStencilInfix returns the result type of a binary operator with a
+// struct or tuple operand. Only '==' and '!=' between two slots of the same
+// layout are defined; ok is false when neither operand is a stencil.
+func (c *Compiler) inferStencilInfix(e *parser.InfixExpression) (tag value.TypeTag, ok bool, err error) {
+	left, leftOk := c.lookupStencilSymbol(e.Left)
+	right, rightOk := c.lookupStencilSymbol(e.Right)
+	if !leftOk && !rightOk {
+		return 0, false, nil
+	}
+	if e.Operator != "==" && e.Operator != "!=" {
+		return 0, true, fmt.Errorf("operator '%s' not defined for structs and tuples", e.Operator)
+	}
+	if !leftOk || !rightOk || !left.Stencil.sameLayout(right.Stencil) {
+		return 0, true, fmt.Errorf("operator '%s' requires two structs or tuples of the same type, got '%s' and '%s'", e.Operator, e.Left.String(), e.Right.String())
+	}
+	return value.TagBoolean, true, nil
+}
+
+// compileStencilCompare compares two stencil slots byte for byte with
+// OpStencilEQ; '!=' negates the result.
+func (c *Compiler) compileStencilCompare(b *ByteCode, e *parser.InfixExpression) error {
+	left, _ := c.lookupStencilSymbol(e.Left)
+	right, _ := c.lookupStencilSymbol(e.Right)
+	b.EmitField(OpStencilEQ, left.SlotID, right.SlotID, 0, e.Position().Line)
+	if e.Operator == "!=" {
+		b.Emit(OpLogicNOT, e.Position().Line)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/mwantia/vega/pkg/parser"
+	"github.com/mwantia/vega/pkg/value"
+)
+
+// Function is a compiled user-defined function. Each function owns its own
+// bytecode; calls push a new CallFrame whose BasePointer offsets all slot IDs,
+// so parameters always occupy slots 0..n-1 of the frame.
+type Function struct {
+	Name       string
+	Parameters []SymbolInfo
+	Returns    value.TypeTag // 0 = returns no value
+	ByteCode   *ByteCode
+}
+
+// LookupFunction returns the function registered under name and its index.
+func (c *Compiler) LookupFunction(name string) (*Function, int, bool) {
+	for i, fn := range c.functions {
+		if fn.Name == name {
+			return fn, i, true
+		}
+	}
+	return nil, -1, false
+}
+
+func (c *Compiler) compileFunction(s *parser.FunctionStatement) error {
+	if c.scope != nil {
+		return fmt.Errorf("function '%s' must be declared at top level", s.Name.Value)
+	}
+	if _, exists := intrinsics[s.Name.Value]; exists {
+		return fmt.Errorf("function '%s' shadows a built-in", s.Name.Value)
+	}
+	if _, _, exists := c.LookupFunction(s.Name.Value); exists {
+		return fmt.Errorf("function '%s' is already defined", s.Name.Value)
+	}
+
+	fn := &Function{
+		Name:       s.Name.Value,
+		Parameters: make([]SymbolInfo, 0, len(s.Parameters)),
+		ByteCode: &ByteCode{
+			Instructions: make([]Instruction, 0),
+			Constants:    make([]Constant, 0),
+		},
+	}
+	if s.ReturnType != nil {
+		tag, ok := value.TagForName(s.ReturnType.Value)
+		if !ok {
+			return fmt.Errorf("function '%s': unknown return type '%s'", fn.Name, s.ReturnType.Value)
+		}
+		fn.Returns = tag
+	}
+
+	scope := newSymbolTable()
+	for _, param := range s.Parameters {
+		if len(param.Constraints) == 0 {
+			return fmt.Errorf("function '%s': parameter '%s' needs a type", fn.Name, param.Value)
+		}
+		tag, mask, err := c.resolveConstraints(param.Constraints)
+		if err != nil {
+			return fmt.Errorf("function '%s': parameter '%s': %v", fn.Name, param.Value, err)
+		}
+		if _, exists := scope.Lookup(param.Value); exists {
+			return fmt.Errorf("function '%s': duplicate parameter '%s'", fn.Name, param.Value)
+		}
+		fn.Parameters = append(fn.Parameters, scope.Define(param.Value, tag, mask))
+	}
+
+	// Register before compiling the body so the function can call itself
+	c.functions = append(c.functions, fn)
+
+	outerScope, outerFunction, outerLoops := c.scope, c.function, c.loopBlocks
+	c.scope, c.function, c.loopBlocks = scope, fn, nil
+	defer func() {
+		c.scope, c.function, c.loopBlocks = outerScope, outerFunction, outerLoops
+	}()
+
+	// Prologue: arguments were pushed left to right, so bind them in reverse
+	b := fn.ByteCode
+	line := s.Position().Line
+	for _, param := range fn.Parameters {
+		emitSlotAlloc(b, param, line)
+	}
+	for i := len(fn.Parameters) - 1; i >= 0; i-- {
+		emitSlotStore(b, fn.Parameters[i], line)
+	}
+
+	for _, stmt := range s.Body.Statements {
+		if err := c.compileStatement(b, stmt); err != nil {
+			c.functions = c.functions[:len(c.functions)-1]
+			return fmt.Errorf("function '%s': %v", fn.Name, err)
+		}
+	}
+
+	if !blockReturns(s.Body) {
+		if fn.Returns != 0 {
+			c.functions = c.functions[:len(c.functions)-1]
+			return fmt.Errorf("function '%s': missing return at end of function", fn.Name)
+		}
+		b.EmitArg(OpFnRETURN, 0, line)
+	}
+	return nil
+}
+
+func (c *Compiler) compileReturn(b *ByteCode, s *parser.ReturnStatement) error {
+	fn := c.function
+	if fn == nil {
+		return fmt.Errorf("'return' outside function at line %d", s.Position().Line)
+	}
+	if c.atomics > 0 {
+		return fmt.Errorf("'return' cannot leave an atomic block at line %d", s.Position().Line)
+	}
+
+	if s.Value == nil {
+		if fn.Returns != 0 {
+			name, _ := value.NameForTag(fn.Returns)
+			return fmt.Errorf("function '%s' must return %s", fn.Name, name)
+		}
+		b.EmitArg(OpFnRETURN, 0, s.Position().Line)
+		return nil
+	}
+
+	tag, err := c.inferTypeTag(s.Value)
+	if err != nil {
+		return fmt.Errorf("return value: %v", err)
+	}
+	if fn.Returns == 0 {
+		if hasBareReturn(fn) {
+			return fmt.Errorf("function '%s' mixes 'return' with and without a value", fn.Name)
+		}
+		// The first return statement decides the return type
+		fn.Returns = tag
+	}
+	if tag != fn.Returns {
+		want, _ := value.NameForTag(fn.Returns)
+		got, _ := value.NameForTag(tag)
+		return fmt.Errorf("function '%s' returns %s, got %s", fn.Name, want, got)
+	}
+
+	if err := c.compileExpression(b, s.Value); err != nil {
+		return fmt.Errorf("return value: %v", err)
+	}
+	b.EmitArg(OpFnRETURN, 1, s.Position().Line)
+	return nil
+}
+
+// compileFunctionCall pushes the arguments and emits OpCallFN. Argument types
+// are checked against the parameter masks where they can be inferred.
+func (c *Compiler) compileFunctionCall(b *ByteCode, fn *Function, index int, args []parser.Expression, line int) error {
+	if c.scope == nil {
+		return fmt.Errorf("call to '%s' outside alloc block", fn.Name)
+	}
+	if len(args) != len(fn.Parameters) {
+		return fmt.Errorf("function '%s' expects %d arguments, got %d", fn.Name, len(fn.Parameters), len(args))
+	}
+	for i, arg := range args {
+		arg, err := coerceLiteral(arg, fn.Parameters[i].Mask)
+		if err != nil {
+			return fmt.Errorf("argument %d of call to '%s': %v", i, fn.Name, err)
+		}
+		tag, err := c.inferTypeTag(arg)
+		if err != nil {
+			return fmt.Errorf("argument %d of call to '%s': %v", i, fn.Name, err)
+		}
+		if !fn.Parameters[i].Accepts(tag) {
+			name, _ := value.NameForTag(tag)
+			return fmt.Errorf("argument %d of call to '%s': type mismatch: parameter mask %08b does not allow %s", i, fn.Name, fn.Parameters[i].Mask, name)
+		}
+		if err := c.compileExpression(b, arg); err != nil {
+			return fmt.Errorf("argument %d of call to '%s': %v", i, fn.Name, err)
+		}
+	}
+	b.EmitNameArg(OpCallFN, fn.Name, index, line)
+	return nil
+}
+
+// hasBareReturn reports whether a 'return' without value was already
+// emitted into the function's bytecode.
+func hasBareReturn(fn *Function) bool {
+	for _, instr := range fn.ByteCode.Instructions {
+		if instr.Operation == OpFnRETURN && instr.Argument == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// blockReturns reports whether every path through the block ends in a
+// return statement. Only the last statement is inspected: either a return,
+// or an if/else whose branches both return.
+func blockReturns(block *parser.BlockStatement) bool {
+	if block == nil || len(block.Statements) == 0 {
+		return false
+	}
+	switch s := block.Statements[len(block.Statements)-1].(type) {
+	case *parser.ReturnStatement:
+		return true
+	case *parser.IfStatement:
+		return s.Alternative != nil && blockReturns(s.Consequence) && blockReturns(s.Alternative)
+	default:
+		return false
+	}
+}
+
+// lowestTagInMask returns the tag of the lowest bit set in mask.
+func lowestTagInMask(mask byte) value.TypeTag {
+	for tag := value.TypeTag(1); tag <= value.TagLastMasked; tag++ {
+		if value.TagInMask(tag, mask) {
+			return tag
+		}
+	}
+	return 0
+}
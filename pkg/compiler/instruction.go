@@ -1,34 +1,111 @@
 package compiler
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/mwantia/vega/pkg/alloc"
+)
 
 type Instruction struct {
 	Operation  OperationCode
-	Argument   int    // Numeric argument (index, count or offset)
-	Offset     int    // Field byte offset (for OpFieldLOAD/OpFieldSTORE)
-	Name       string // String argument (variable name or function name)
-	Extra      byte   // Extra byte (carries type tag for OpVarALLOC)
-	SourceLine int    // Source line number for error reporting
+	Argument   int              // Numeric argument (index, count or offset)
+	Offset     int              // Field byte offset (for OpFieldLOAD/OpFieldSTORE), element count (for OpArrayALLOC), second slot ID (for OpStencilCOPY/OpStencilEQ), pool slot size (for OpStackALLOC)
+	Name       string           // String argument (variable name or function name)
+	Extra      byte             // Extra byte (type bitmask for OpVarALLOC, return count for OpCallNAT, allocator strategy for OpStackALLOC)
+	Auto       int              // Capacity computed for an 'alloc auto' block (for OpStackALLOC), shown by the disassembly only
+	Persistent *PersistentArena // File of an 'alloc ... from' block (for OpStackALLOC), nil for other blocks
+	SourceLine int              // Source line number for error reporting
 }
 
+// Flags of OpVarFREE, in Extra.
+const (
+	FreeScoped byte = 1 << iota // a block local going out of scope, rather than free(x)
+	FreeEarly                   // released before a break or continue jumps out of the block
+)
+
 func (i *Instruction) String() string {
 	switch i.Operation {
 	case OpStackALLOC:
-		return fmt.Sprintf("%s capacity=%d", i.Operation, i.Argument)
+		out := i.Operation.String()
+		switch alloc.Strategy(i.Extra) {
+		case alloc.StrategyFreeList:
+		case alloc.StrategyPool:
+			out = fmt.Sprintf("%s pool=%d", out, i.Offset)
+		default:
+			out = fmt.Sprintf("%s %s", out, alloc.Strategy(i.Extra))
+		}
+		if i.Auto > 0 {
+			out = fmt.Sprintf("%s auto=%d", out, i.Auto)
+		}
+		if i.Argument == 1 {
+			out += " grow"
+		}
+		if p := i.Persistent; p != nil {
+			out = fmt.Sprintf("%s from=%q layout=%016x", out, p.Path, p.Fingerprint)
+		}
+		return out
+	case OpStackFREE:
+		if i.Argument == 1 {
+			return fmt.Sprintf("%s strict", i.Operation)
+		}
+		return i.Operation.String()
 	case OpLoadCONST:
 		return fmt.Sprintf("%s index=%d", i.Operation, i.Argument)
 	case OpVarALLOC:
 		return fmt.Sprintf("%s slot=%d mask=%08b", i.Operation, i.Argument, i.Extra)
 	case OpVarPTR:
 		return fmt.Sprintf("%s slot=%d tag=%d", i.Operation, i.Argument, i.Extra)
-	case OpVarSTORE, OpVarLOAD, OpVarFREE:
+	case OpVarFREE:
+		out := fmt.Sprintf("%s slot=%d", i.Operation, i.Argument)
+		if i.Extra&FreeScoped != 0 {
+			out += " scoped"
+		}
+		if i.Extra&FreeEarly != 0 {
+			out += " early"
+		}
+		return out
+	case OpVarSTORE, OpVarLOAD:
 		return fmt.Sprintf("%s slot=%d", i.Operation, i.Argument)
 	case OpStencilALLOC:
 		return fmt.Sprintf("%s slot=%d size=%d", i.Operation, i.Argument, i.Offset)
+	case OpStencilCOPY:
+		return fmt.Sprintf("%s slot=%d src=%d", i.Operation, i.Argument, i.Offset)
+	case OpStencilEQ:
+		return fmt.Sprintf("%s slot=%d other=%d", i.Operation, i.Argument, i.Offset)
 	case OpFieldSTORE, OpFieldLOAD:
 		return fmt.Sprintf("%s slot=%d offset=%d tag=%d", i.Operation, i.Argument, i.Offset, i.Extra)
 	case OpCallNAT:
+		if i.Extra > 0 {
+			return fmt.Sprintf("%s %s argc=%d returns=%d", i.Operation, i.Name, i.Argument, i.Extra)
+		}
 		return fmt.Sprintf("%s %s argc=%d", i.Operation, i.Name, i.Argument)
+	case OpCallFN:
+		return fmt.Sprintf("%s %s index=%d", i.Operation, i.Name, i.Argument)
+	case OpFnRETURN, OpStrFORMAT:
+		return fmt.Sprintf("%s count=%d", i.Operation, i.Argument)
+	case OpArrayALLOC:
+		return fmt.Sprintf("%s slot=%d len=%d tag=%d", i.Operation, i.Argument, i.Offset, i.Extra)
+	case OpArrayLOAD, OpArraySTORE:
+		return fmt.Sprintf("%s slot=%d tag=%d", i.Operation, i.Argument, i.Extra)
+	case OpStrALLOC:
+		if i.Extra == 1 {
+			return fmt.Sprintf("%s slot=%d declared", i.Operation, i.Argument)
+		}
+		return fmt.Sprintf("%s slot=%d", i.Operation, i.Argument)
+	case OpArrayLEN, OpStrSTORE, OpStrLOAD:
+		return fmt.Sprintf("%s slot=%d", i.Operation, i.Argument)
+	case OpTagCONVERT:
+		if i.Argument == 1 {
+			return fmt.Sprintf("%s tag=%d strict", i.Operation, i.Extra)
+		}
+		return fmt.Sprintf("%s tag=%d", i.Operation, i.Extra)
+	case OpJMP, OpJMP_IF_FALSE, OpJMP_IF_TRUE:
+		return fmt.Sprintf("%s addr=%d", i.Operation, i.Argument)
+	case OpAtomicBEGIN:
+		if i.Extra == 1 {
+			return fmt.Sprintf("%s addr=%d else", i.Operation, i.Argument)
+		}
+		return fmt.Sprintf("%s addr=%d", i.Operation, i.Argument)
 	}
 
 	return i.Operation.String()
@@ -0,0 +1,125 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/mwantia/vega/pkg/parser"
+	"github.com/mwantia/vega/pkg/value"
+)
+
+// intrinsic is a built-in function that the compiler lowers to dedicated
+// opcodes instead of a CALL_FN or CALL_NAT. Intrinsic names cannot be used
+// for user-defined functions.
+type intrinsic struct {
+	infer   func(c *Compiler, args []parser.Expression) (value.TypeTag, error)
+	compile func(c *Compiler, b *ByteCode, args []parser.Expression, line int) error
+}
+
+var intrinsics map[string]intrinsic
+
+func init() {
+	intrinsics = map[string]intrinsic{
+		"len":     {inferLen, compileLen},
+		"compact": {inferCompact, compileCompact},
+	}
+	for _, name := range []string{"byte", "short", "int", "long", "float", "decimal", "char", "bool"} {
+		tag, _ := value.TagForName(name)
+		intrinsics[name] = conversion(name, tag)
+	}
+}
+
+// lookupIntrinsic resolves the callee of a call expression to an intrinsic.
+func lookupIntrinsic(function parser.Expression) (string, intrinsic, bool) {
+	ident, ok := function.(*parser.IdentifierExpression)
+	if !ok {
+		return "", intrinsic{}, false
+	}
+	in, ok := intrinsics[ident.Value]
+	return ident.Value, in, ok
+}
+
+// len(array) pushes the element count of an array, len(string) the byte
+// length of a string, both as int.
+func inferLen(c *Compiler, args []parser.Expression) (value.TypeTag, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("len expects 1 argument, got %d", len(args))
+	}
+	if tag, err := c.inferTypeTag(args[0]); err == nil && tag == value.TagString {
+		return value.TagInteger, nil
+	}
+	if _, err := c.lookupArray(args[0]); err != nil {
+		return 0, fmt.Errorf("len: %v", err)
+	}
+	return value.TagInteger, nil
+}
+
+func compileLen(c *Compiler, b *ByteCode, args []parser.Expression, line int) error {
+	if _, err := inferLen(c, args); err != nil {
+		return err
+	}
+	if tag, _ := c.inferTypeTag(args[0]); tag == value.TagString {
+		if err := c.compileExpression(b, args[0]); err != nil {
+			return err
+		}
+		b.Emit(OpStrLEN, line)
+		return nil
+	}
+	info, _ := c.lookupArray(args[0])
+	b.EmitArg(OpArrayLEN, info.SlotID, line)
+	return nil
+}
+
+// compact() defragments the innermost arena and returns the number of bytes
+// it moved as int.
+func inferCompact(c *Compiler, args []parser.Expression) (value.TypeTag, error) {
+	if len(args) != 0 {
+		return 0, fmt.Errorf("compact expects 0 arguments, got %d", len(args))
+	}
+	if c.scope == nil {
+		return 0, fmt.Errorf("compact outside alloc block")
+	}
+	return value.TagInteger, nil
+}
+
+func compileCompact(c *Compiler, b *ByteCode, args []parser.Expression, line int) error {
+	if _, err := inferCompact(c, args); err != nil {
+		return err
+	}
+	b.Emit(OpArenaCOMPACT, line)
+	return nil
+}
+
+// conversion builds the intrinsic named after a type, such as long(x), which
+// converts a numeric or boolean value to that type with OpTagCONVERT. See
+// value.Convert for the truncation, overflow and rounding rules.
+func conversion(name string, tag value.TypeTag) intrinsic {
+	infer := func(c *Compiler, args []parser.Expression) (value.TypeTag, error) {
+		if len(args) != 1 {
+			return 0, fmt.Errorf("%s expects 1 argument, got %d", name, len(args))
+		}
+		from, err := c.inferTypeTag(args[0])
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", name, err)
+		}
+		if !value.IsNumericTag(from) && from != value.TagBoolean {
+			fromName, _ := value.NameForTag(from)
+			return 0, fmt.Errorf("cannot convert %s to %s", value.NameOrUnknown(fromName), name)
+		}
+		return tag, nil
+	}
+	compile := func(c *Compiler, b *ByteCode, args []parser.Expression, line int) error {
+		if _, err := infer(c, args); err != nil {
+			return err
+		}
+		if err := c.compileExpression(b, args[0]); err != nil {
+			return err
+		}
+		strict := 0
+		if c.strict {
+			strict = 1
+		}
+		b.EmitArgExtra(OpTagCONVERT, strict, byte(tag), line)
+		return nil
+	}
+	return intrinsic{infer, compile}
+}
@@ -0,0 +1,293 @@
+package compiler
+
+import (
+	"fmt"
+	"slices"
+)
+
+// The lifetime analysis runs over the bytecode of a program and of the
+// functions it declares once they compiled. The scope of the compiler
+// forgets a name after a free(x) that runs on every path through its block;
+// a free inside a loop or a branch keeps the name and leaves the slot freed
+// on some paths and live on others. The analysis follows every jump until the states of all
+// slots are stable and then reports, for each instruction, what they allow:
+// a use or free of a slot that may be freed, a pointer alias that may view
+// freed memory, and a slot that may leak.
+
+// Diagnostic is a problem found by the lifetime analysis, at the source
+// line of the instruction it concerns.
+type Diagnostic struct {
+	Line     int
+	Message  string
+	Definite bool // found on every path reaching the instruction, not only some
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("line %d: %s", d.Line, d.Message)
+}
+
+const (
+	slotLive  byte = 1 << iota // allocated and not freed since, on some path
+	slotFreed                  // freed, on some path
+)
+
+// lifetime is the state of a slot when an instruction executes, over all
+// paths that reach it.
+type lifetime struct {
+	state byte // slotLive and slotFreed, 0 before the slot is allocated
+	alias bool // the slot is a pointer alias and owns no memory
+	site  int  // address of the allocating instruction, the key of its name
+	freed int  // source line of a free that reaches the instruction
+}
+
+type lifetimes []lifetime
+
+// join merges the states of other into l and reports whether l changed.
+func (l lifetimes) join(other lifetimes) bool {
+	changed := false
+	for id, in := range other {
+		if in.state == 0 {
+			continue
+		}
+		out := l[id]
+		if out.state == 0 {
+			out.alias, out.site = in.alias, in.site
+		}
+		out.state |= in.state
+		if in.freed > 0 && (out.freed == 0 || in.freed < out.freed) {
+			out.freed = in.freed
+		}
+		if out != l[id] {
+			l[id] = out
+			changed = true
+		}
+	}
+	return changed
+}
+
+type lifetimeAnalysis struct {
+	b           *ByteCode
+	slots       int           // number of slot IDs used by b
+	blocks      map[int][]int // slots allocated by each alloc block, by address of its STACK_FREE
+	views       map[int][]int // slots each alias load or store reaches, by address
+	diagnostics []Diagnostic
+}
+
+// checkLifetimes analyses the bytecode of a program and of the functions it
+// declares, and returns the diagnostics ordered by line.
+func (c *Compiler) checkLifetimes(b *ByteCode, functions []*Function) []Diagnostic {
+	diagnostics := c.analyseLifetimes(b)
+	for _, fn := range functions {
+		diagnostics = append(diagnostics, c.analyseLifetimes(fn.ByteCode)...)
+	}
+	slices.SortStableFunc(diagnostics, func(a, b Diagnostic) int {
+		return a.Line - b.Line
+	})
+	return diagnostics
+}
+
+func (c *Compiler) analyseLifetimes(b *ByteCode) []Diagnostic {
+	a := &lifetimeAnalysis{
+		b:      b,
+		blocks: make(map[int][]int),
+		views:  make(map[int][]int),
+	}
+
+	// Slot IDs of sibling blocks are reused, so every STACK_FREE resets
+	// the slots its block allocated
+	var open [][]int
+	for addr, instr := range b.Instructions {
+		switch instr.Operation {
+		case OpStackALLOC:
+			open = append(open, nil)
+			views, err := c.aliasViews(b, addr)
+			if err != nil {
+				// The VM rejects the block as well; its aliases are left unchecked
+				a.diagnostics = append(a.diagnostics, Diagnostic{Line: instr.SourceLine, Message: fmt.Sprintf("%v; the aliases of the block are not checked", err)})
+			}
+			for at, viewed := range views {
+				a.views[at] = viewed
+			}
+		case OpStackFREE:
+			if n := len(open); n > 0 {
+				a.blocks[addr] = open[n-1]
+				open = open[:n-1]
+			}
+		}
+		for _, id := range slotOperands(instr) {
+			a.slots = max(a.slots, id+1)
+			if allocates(instr.Operation) && len(open) > 0 {
+				open[len(open)-1] = append(open[len(open)-1], id)
+			}
+		}
+	}
+
+	states := a.solve()
+	for addr, instr := range b.Instructions {
+		if states[addr] != nil {
+			a.check(addr, instr, states[addr])
+		}
+	}
+	return a.diagnostics
+}
+
+// solve returns the states of all slots before each instruction, nil for
+// instructions no path reaches.
+func (a *lifetimeAnalysis) solve() []lifetimes {
+	instructions := a.b.Instructions
+	states := make([]lifetimes, len(instructions))
+	if len(instructions) == 0 {
+		return states
+	}
+	states[0] = make(lifetimes, a.slots)
+
+	work := []int{0}
+	for len(work) > 0 {
+		addr := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		out := slices.Clone(states[addr])
+		a.transfer(addr, instructions[addr], out)
+		for _, next := range successors(addr, instructions[addr], len(instructions)) {
+			if states[next] == nil {
+				states[next] = slices.Clone(out)
+				work = append(work, next)
+			} else if states[next].join(out) {
+				work = append(work, next)
+			}
+		}
+	}
+	return states
+}
+
+// transfer applies the effect of instr on the slot states l.
+func (a *lifetimeAnalysis) transfer(addr int, instr Instruction, l lifetimes) {
+	switch op := instr.Operation; {
+	case allocates(op):
+		l[instr.Argument] = lifetime{state: slotLive, alias: op == OpVarPTR, site: addr}
+	case op == OpVarFREE:
+		l[instr.Argument].state = slotFreed
+		l[instr.Argument].freed = instr.SourceLine
+	case op == OpStackFREE:
+		for _, id := range a.blocks[addr] {
+			l[id] = lifetime{}
+		}
+	}
+}
+
+// check reports what instr does to slots that may be freed or leaked.
+func (a *lifetimeAnalysis) check(addr int, instr Instruction, l lifetimes) {
+	switch op := instr.Operation; {
+	case allocates(op):
+		slot := l[instr.Argument]
+		if slot.state&slotLive != 0 && !slot.alias && op != OpVarPTR {
+			a.report(instr, slot.state == slotLive, "leak of %s; it is allocated again while still live", a.name(instr.Argument, l))
+		}
+	case op == OpVarFREE:
+		slot := l[instr.Argument]
+		// A local going out of scope may have been freed in a branch
+		if slot.state&slotFreed != 0 && instr.Extra&FreeScoped == 0 {
+			a.report(instr, slot.state == slotFreed, "double free of %s; it is freed at line %d", a.name(instr.Argument, l), slot.freed)
+		}
+	case op == OpStackFREE:
+		// A slot still allocated when its block exits is a leak, as for the
+		// VM's leak check. Slots never freed are left to that check; those
+		// freed on some paths only are reported where they are allocated
+		for _, id := range a.blocks[addr] {
+			if l[id].state == slotLive|slotFreed && !l[id].alias {
+				a.report(a.b.Instructions[l[id].site], false, "leak of %s; it is still allocated when the block exits on the paths that skip the free at line %d",
+					a.name(id, l), l[id].freed)
+			}
+		}
+	default:
+		for _, id := range slotOperands(instr) {
+			slot := l[id]
+			if slot.alias {
+				a.checkAlias(addr, instr, l)
+				continue
+			}
+			if slot.state&slotFreed != 0 {
+				a.report(instr, slot.state == slotFreed, "use after free of %s; it is freed at line %d", a.name(id, l), slot.freed)
+			}
+		}
+	}
+}
+
+// checkAlias reports an alias load or store that reaches memory of a slot
+// that may be freed. The memory model allows it, but the value read is
+// whatever the bytes hold, so it is only a diagnostic like the others.
+func (a *lifetimeAnalysis) checkAlias(addr int, instr Instruction, l lifetimes) {
+	access := "loads"
+	if instr.Operation == OpVarSTORE {
+		access = "stores to"
+	}
+	for _, id := range a.views[addr] {
+		if slot := l[id]; slot.state&slotFreed != 0 && !slot.alias {
+			a.report(instr, slot.state == slotFreed, "alias %s %s freed memory of %s; it is freed at line %d",
+				a.name(instr.Argument, l), access, a.name(id, l), slot.freed)
+		}
+	}
+}
+
+// report adds a diagnostic. Problems that only occur on some of the paths
+// reaching the instruction are marked as possible.
+func (a *lifetimeAnalysis) report(instr Instruction, definite bool, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	if !definite {
+		message = "possible " + message
+	}
+	a.diagnostics = append(a.diagnostics, Diagnostic{Line: instr.SourceLine, Message: message, Definite: definite})
+}
+
+// name returns the variable name of slot id from the debug symbols.
+func (a *lifetimeAnalysis) name(id int, l lifetimes) string {
+	if name, ok := a.b.Symbols[l[id].site]; ok {
+		return fmt.Sprintf("'%s'", name)
+	}
+	return fmt.Sprintf("slot %d", id)
+}
+
+// allocates reports whether op binds a slot to new memory or, for VAR_PTR,
+// to an alias.
+func allocates(op OperationCode) bool {
+	switch op {
+	case OpVarALLOC, OpVarPTR, OpStencilALLOC, OpArrayALLOC, OpStrALLOC:
+		return true
+	}
+	return false
+}
+
+// slotOperands returns the slot IDs instr reads, writes or binds.
+func slotOperands(instr Instruction) []int {
+	switch instr.Operation {
+	case OpVarALLOC, OpVarPTR, OpStencilALLOC, OpArrayALLOC, OpStrALLOC,
+		OpVarSTORE, OpVarLOAD, OpVarFREE, OpFieldSTORE, OpFieldLOAD,
+		OpArrayLOAD, OpArraySTORE, OpArrayLEN, OpStrSTORE, OpStrLOAD:
+		return []int{instr.Argument}
+	case OpStencilCOPY, OpStencilEQ:
+		return []int{instr.Argument, instr.Offset}
+	}
+	return nil
+}
+
+// successors returns the addresses that may execute after instr.
+func successors(addr int, instr Instruction, end int) []int {
+	var next []int
+	switch instr.Operation {
+	case OpFnRETURN:
+		return nil
+	case OpJMP:
+		next = append(next, instr.Argument)
+	case OpJMP_IF_FALSE, OpJMP_IF_TRUE:
+		next = append(next, instr.Argument, addr+1)
+	case OpAtomicBEGIN:
+		// A rollback restores the state before the block and resumes there
+		next = append(next, instr.Argument, addr+1)
+	default:
+		next = append(next, addr+1)
+	}
+	// A jump past the last instruction ends the bytecode
+	return slices.DeleteFunc(next, func(to int) bool {
+		return to >= end
+	})
+}
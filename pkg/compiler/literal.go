@@ -0,0 +1,132 @@
+package compiler
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/mwantia/vega/pkg/lexer"
+	"github.com/mwantia/vega/pkg/parser"
+	"github.com/mwantia/vega/pkg/value"
+)
+
+// Unsuffixed numeric literals are int or decimal. When they are stored into
+// a slot whose mask does not allow that tag, such as 'count: long = 0', the
+// compiler rewrites them to the narrowest tag of the mask that holds them.
+// Integer tags are tried before float tags, each from narrow to wide; char
+// and bool are never chosen. Suffixed literals (1b, 2s, 3l, 4.0f) keep their
+// tag.
+var (
+	integerCoercions = []value.TypeTag{value.TagByte, value.TagShort, value.TagLong, value.TagFloat, value.TagDecimal}
+	decimalCoercions = []value.TypeTag{value.TagFloat}
+)
+
+// numericLiteral is an unsuffixed literal, optionally negated.
+type numericLiteral struct {
+	token   lexer.Token
+	integer bool
+	i       int64
+	f       float64
+}
+
+func asNumericLiteral(expr parser.Expression) (numericLiteral, bool) {
+	switch e := expr.(type) {
+	case *parser.IntegerExpression:
+		return numericLiteral{token: e.Token, integer: true, i: int64(e.Value), f: float64(e.Value)}, true
+	case *parser.DecimalExpression:
+		return numericLiteral{token: e.Token, f: e.Value}, true
+	case *parser.PrefixExpression:
+		if e.Operator != "-" {
+			return numericLiteral{}, false
+		}
+		lit, ok := asNumericLiteral(e.Right)
+		if !ok {
+			return numericLiteral{}, false
+		}
+		lit.i, lit.f = -lit.i, -lit.f
+		return lit, true
+	}
+	return numericLiteral{}, false
+}
+
+func (lit numericLiteral) String() string {
+	if lit.integer {
+		return fmt.Sprintf("%d", lit.i)
+	}
+	return fmt.Sprintf("%g", lit.f)
+}
+
+// coerceLiteral returns expr rewritten to a literal of the narrowest tag in
+// mask that holds its value exactly (floats may round). Anything that is not
+// an unsuffixed numeric literal, and literals whose own tag the mask already
+// allows, are returned unchanged. A literal that fits none of the mask's
+// numeric tags, or whose mask has none it could become, is a compile error.
+func coerceLiteral(expr parser.Expression, mask byte) (parser.Expression, error) {
+	lit, ok := asNumericLiteral(expr)
+	if !ok || mask == 0 {
+		return expr, nil
+	}
+
+	own, candidates := value.TagDecimal, decimalCoercions
+	if lit.integer {
+		own, candidates = value.TagInteger, integerCoercions
+	}
+	if value.TagInMask(own, mask) {
+		return expr, nil
+	}
+
+	pos := expr.Position()
+	var allowed []string
+	for _, tag := range candidates {
+		if !value.TagInMask(tag, mask) {
+			continue
+		}
+		if coerced, ok := lit.as(tag); ok {
+			return coerced, nil
+		}
+		name, _ := value.NameForTag(tag)
+		allowed = append(allowed, name)
+	}
+	if len(allowed) == 0 {
+		// No numeric tag to coerce to, so the store would fail at runtime
+		var names []string
+		for tag := value.TypeTag(1); tag <= value.TagLastMasked; tag++ {
+			if name, ok := value.NameForTag(tag); ok && value.TagInMask(tag, mask) {
+				names = append(names, name)
+			}
+		}
+		return nil, fmt.Errorf("literal %s cannot be stored as %s at line %d, column %d", lit, strings.Join(names, "|"), pos.Line, pos.Column)
+	}
+	return nil, fmt.Errorf("literal %s out of range for %s at line %d, column %d", lit, strings.Join(allowed, "|"), pos.Line, pos.Column)
+}
+
+// as returns the literal as an expression of the given tag, or false if the
+// value does not fit.
+func (lit numericLiteral) as(tag value.TypeTag) (parser.Expression, bool) {
+	switch tag {
+	case value.TagByte:
+		if !lit.integer || lit.i < 0 || lit.i > math.MaxUint8 {
+			return nil, false
+		}
+		return &parser.ByteExpression{Token: lit.token, Value: byte(lit.i)}, true
+	case value.TagShort:
+		if !lit.integer || lit.i < math.MinInt16 || lit.i > math.MaxInt16 {
+			return nil, false
+		}
+		return &parser.ShortExpression{Token: lit.token, Value: int16(lit.i)}, true
+	case value.TagLong:
+		if !lit.integer {
+			return nil, false
+		}
+		return &parser.LongExpression{Token: lit.token, Value: lit.i}, true
+	case value.TagFloat:
+		f := float32(lit.f)
+		if math.IsInf(float64(f), 0) || (lit.integer && int64(f) != lit.i) {
+			return nil, false
+		}
+		return &parser.FloatExpression{Token: lit.token, Value: f}, true
+	case value.TagDecimal:
+		return &parser.DecimalExpression{Token: lit.token, Value: lit.f}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,62 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/mwantia/vega/pkg/parser"
+	"github.com/mwantia/vega/pkg/value"
+)
+
+// NativeSignature describes the values a native function pushes onto the
+// expression stack. The compiler cannot see the Go implementation, so the
+// return types have to be declared when the native is registered.
+type NativeSignature struct {
+	Name    string
+	Returns []value.TypeTag
+}
+
+var nativeSignatures = map[string]NativeSignature{}
+
+// RegisterNativeSignature declares the return types of a native function.
+// vm.RegisterNative calls this for every native it registers.
+func RegisterNativeSignature(name string, returns ...value.TypeTag) {
+	nativeSignatures[name] = NativeSignature{
+		Name:    name,
+		Returns: returns,
+	}
+}
+
+// LookupNativeSignature returns the declared signature of a native function.
+func LookupNativeSignature(name string) (NativeSignature, bool) {
+	sig, ok := nativeSignatures[name]
+	return sig, ok
+}
+
+// compileNativeCall pushes the arguments and emits OpCallNAT. The number of
+// declared return values travels in Extra so the runtime can verify that the
+// native pushed what the compiler expects. Natives without a declared
+// signature are resolved at runtime and must not return anything.
+func (c *Compiler) compileNativeCall(b *ByteCode, name string, args []parser.Expression, line int) (NativeSignature, error) {
+	sig, _ := LookupNativeSignature(name)
+	for i, arg := range args {
+		if err := c.compileExpression(b, arg); err != nil {
+			return sig, fmt.Errorf("argument %d of call to '%s': %v", i, name, err)
+		}
+	}
+	addr := b.EmitNameArg(OpCallNAT, name, len(args), line)
+	b.Instructions[addr].Extra = byte(len(sig.Returns))
+	return sig, nil
+}
+
+// singleReturn returns the only return type of sig, or an error when the
+// native cannot be used as an expression.
+func (sig NativeSignature) singleReturn() (value.TypeTag, error) {
+	switch len(sig.Returns) {
+	case 0:
+		return 0, fmt.Errorf("native function '%s' does not return a value", sig.Name)
+	case 1:
+		return sig.Returns[0], nil
+	default:
+		return 0, fmt.Errorf("native function '%s' returns %d values; only single-value calls can be used in expressions", sig.Name, len(sig.Returns))
+	}
+}
@@ -5,14 +5,14 @@ type OperationCode byte
 const (
 	OpStackPOP OperationCode = iota
 
-	OpStackALLOC
-	OpStackFREE
+	OpStackALLOC // pop capacity (and growth ceiling if arg is 1), enter an alloc block (extra: allocator strategy, offset: pool slot size, loaded from the file of a persistent arena)
+	OpStackFREE  // leave the innermost alloc block (arg: 1 to fail on leaked slots instead of warning)
 	OpLoadCONST
 
 	OpVarALLOC // allocate slot in byte buffer (arg: slot ID, extra: type mask)
 	OpVarSTORE // pop expr stack, copy bytes into slot (arg: slot ID)
 	OpVarLOAD  // copy bytes from slot, push to expr stack (arg: slot ID)
-	OpVarFREE  // return slot memory to free list (arg: slot ID)
+	OpVarFREE  // return slot memory to free list (arg: slot ID, extra: FreeScoped and FreeEarly flags)
 	OpVarPTR   // create alias slot at explicit offset (arg: slot ID, extra: type tag)
 
 	OpStencilALLOC // allocate stencil-sized slot (arg: slot ID, offset: total size)
@@ -20,6 +20,52 @@ const (
 	OpFieldLOAD    // load field from slot (arg: slot ID, offset: field byte offset, extra: type tag)
 
 	OpCallNAT // call a registered native (Go) function (name: function name, arg: argument count)
+
+	OpArithADD // pop right and left, push left + right
+	OpArithSUB // pop right and left, push left - right
+	OpArithMUL // pop right and left, push left * right
+	OpArithDIV // pop right and left, push left / right
+	OpArithMOD // pop right and left, push left % right
+	OpArithNEG // pop operand, push -operand
+
+	OpCmpEQ    // pop right and left, push left == right
+	OpCmpNE    // pop right and left, push left != right
+	OpCmpLT    // pop right and left, push left < right
+	OpCmpLE    // pop right and left, push left <= right
+	OpCmpGT    // pop right and left, push left > right
+	OpCmpGE    // pop right and left, push left >= right
+	OpLogicNOT // pop boolean, push its negation
+
+	OpStackDUP     // push the top value of the expr stack again
+	OpJMP_IF_FALSE // pop boolean, jump if false (arg: target address)
+	OpJMP_IF_TRUE  // pop boolean, jump if true (arg: target address)
+	OpJMP          // jump unconditionally (arg: target address)
+
+	OpCallFN   // call a user-defined function (name: function name, arg: function index)
+	OpFnRETURN // return from the current function (arg: number of return values on the expr stack)
+
+	OpArrayALLOC // allocate a fixed-size array slot (arg: slot ID, offset: element count, extra: element tag)
+	OpArrayLOAD  // pop index, push element (arg: slot ID, extra: element tag)
+	OpArraySTORE // pop value and index, copy value into element (arg: slot ID, extra: element tag)
+	OpArrayLEN   // push the element count of an array slot as int (arg: slot ID)
+
+	OpStrALLOC  // create an empty string slot without memory (arg: slot ID, extra: 1 for a declaration)
+	OpStrSTORE  // pop string, (re)allocate the slot to fit and copy it in (arg: slot ID)
+	OpStrLOAD   // push a view of the string stored in a slot (arg: slot ID)
+	OpStrCONCAT // pop right and left strings, push left + right
+	OpStrLEN    // pop string, push its byte length as int
+	OpStrINDEX  // pop index and string, push the byte at that index
+	OpStrFORMAT // pop Argument values, push the concatenation of their string forms
+
+	OpStencilCOPY // copy a whole stencil slot (arg: destination slot ID, offset: source slot ID)
+	OpStencilEQ   // push whether two stencil slots hold the same bytes (arg: left slot ID, offset: right slot ID)
+
+	OpTagCONVERT // pop value, push it converted to another tag (extra: target tag, arg: 1 for strict)
+
+	OpArenaCOMPACT // slide the live slots of the innermost arena together, push the number of bytes moved as int
+
+	OpAtomicBEGIN // save all arenas and the slot table (arg: address to resume at after a rollback, extra: 1 if an else block handles it)
+	OpAtomicEND   // drop the state saved by the innermost OpAtomicBEGIN
 )
 
 var operationNames = map[OperationCode]string{
@@ -39,6 +85,51 @@ var operationNames = map[OperationCode]string{
 	OpFieldLOAD:    "FIELD_LOAD",
 
 	OpCallNAT: "CALL_NAT",
+
+	OpArithADD: "ARITH_ADD",
+	OpArithSUB: "ARITH_SUB",
+	OpArithMUL: "ARITH_MUL",
+	OpArithDIV: "ARITH_DIV",
+	OpArithMOD: "ARITH_MOD",
+	OpArithNEG: "ARITH_NEG",
+
+	OpCmpEQ:    "CMP_EQ",
+	OpCmpNE:    "CMP_NE",
+	OpCmpLT:    "CMP_LT",
+	OpCmpLE:    "CMP_LE",
+	OpCmpGT:    "CMP_GT",
+	OpCmpGE:    "CMP_GE",
+	OpLogicNOT: "LOGIC_NOT",
+
+	OpStackDUP:     "STACK_DUP",
+	OpJMP_IF_FALSE: "JMP_IF_FALSE",
+	OpJMP_IF_TRUE:  "JMP_IF_TRUE",
+	OpJMP:          "JMP",
+
+	OpCallFN:   "CALL_FN",
+	OpFnRETURN: "FN_RETURN",
+
+	OpArrayALLOC: "ARRAY_ALLOC",
+	OpArrayLOAD:  "ARRAY_LOAD",
+	OpArraySTORE: "ARRAY_STORE",
+	OpArrayLEN:   "ARRAY_LEN",
+
+	OpStrALLOC:  "STR_ALLOC",
+	OpStrSTORE:  "STR_STORE",
+	OpStrLOAD:   "STR_LOAD",
+	OpStrCONCAT: "STR_CONCAT",
+	OpStrLEN:    "STR_LEN",
+	OpStrINDEX:  "STR_INDEX",
+	OpStrFORMAT: "STR_FORMAT",
+
+	OpStencilCOPY: "STENCIL_COPY",
+	OpStencilEQ:   "STENCIL_EQ",
+
+	OpTagCONVERT: "TAG_CONVERT",
+
+	OpArenaCOMPACT: "ARENA_COMPACT",
+	OpAtomicBEGIN:  "ATOMIC_BEGIN",
+	OpAtomicEND:    "ATOMIC_END",
 }
 
 func (op OperationCode) String() string {
@@ -0,0 +1,72 @@
+package compiler
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/mwantia/vega/pkg/alloc"
+)
+
+// PersistentArena names the file that an 'alloc 64 from "/state/x.arena"'
+// block loads its arena from on entry and writes it back to on exit. The
+// file keeps the slots by their ID relative to the block, so it can only
+// be reused by a block with the same layout; the fingerprint tells them
+// apart.
+type PersistentArena struct {
+	Path        string
+	Base        int    // slot ID of the block's first variable
+	Fingerprint uint64 // of the variables left at the end of the block, see layoutFingerprint
+}
+
+// layoutFingerprint hashes what the bytes of a persistent arena mean: the
+// allocator and every variable of the block still defined at its end, by
+// slot ID relative to base, with its name, type and the layout of its
+// stencil. Locals of nested blocks are freed on every pass and not part of
+// it, and neither are pointer aliases, which own no memory.
+func layoutFingerprint(scope *SymbolTable, base int, strategy alloc.Strategy, slotSize int) uint64 {
+	symbols := make([]SymbolInfo, 0, len(scope.symbols))
+	for _, info := range scope.symbols {
+		if !info.Alias {
+			symbols = append(symbols, info)
+		}
+	}
+	slices.SortFunc(symbols, func(a, b SymbolInfo) int {
+		return a.SlotID - b.SlotID
+	})
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s %d\n", strategy, slotSize)
+	for _, info := range symbols {
+		fmt.Fprintf(h, "%d %s", info.SlotID-base, info.Name)
+		switch {
+		case info.Stencil != nil:
+			io.WriteString(h, " "+stencilLayout(info.Stencil))
+		case info.Array:
+			fmt.Fprintf(h, " tag=%d len=%d", info.Tag, info.Length)
+		case info.Mask == 0:
+			fmt.Fprintf(h, " tag=%d", info.Tag) // strings are outside the masks
+		default:
+			// The mask, not the tag of the last store, is what the slot may hold
+			fmt.Fprintf(h, " mask=%d", info.Mask)
+		}
+		io.WriteString(h, "\n")
+	}
+	return h.Sum64()
+}
+
+// stencilLayout describes the name, fields, offsets and tags of a stencil,
+// including the stencils embedded in it.
+func stencilLayout(stencil *Stencil) string {
+	fields := make([]string, len(stencil.Fields))
+	for i, f := range stencil.Fields {
+		if f.Stencil != nil {
+			fields[i] = fmt.Sprintf("%s@%d:%s", f.Name, f.Offset, stencilLayout(f.Stencil))
+			continue
+		}
+		fields[i] = fmt.Sprintf("%s@%d:%d", f.Name, f.Offset, f.Tag)
+	}
+	return fmt.Sprintf("%s{%s}%d", stencil.Name, strings.Join(fields, ","), stencil.TotalSize)
+}
@@ -6,11 +6,22 @@ import (
 	"github.com/mwantia/vega/pkg/value"
 )
 
-// FieldLayout describes a single field within a stencil.
+// FieldLayout describes a single field within a stencil. A field typed as
+// another struct has Tag 0 and Stencil set; its fields are stored inline, so
+// the nested stencil's offsets are relative to the field's Offset.
 type FieldLayout struct {
-	Name   string
-	Offset int           // cumulative byte offset within the stencil
-	Tag    value.TypeTag // type tag for this field
+	Name    string
+	Offset  int           // cumulative byte offset within the stencil
+	Tag     value.TypeTag // type tag for this field
+	Stencil *Stencil      // nested struct layout, nil for primitive fields
+}
+
+// Size returns the number of bytes the field occupies in the stencil.
+func (f FieldLayout) Size() int {
+	if f.Stencil != nil {
+		return f.Stencil.TotalSize
+	}
+	return value.SizeForTag(f.Tag)
 }
 
 // Stencil is a compile-time layout recipe for packing primitive fields
@@ -24,8 +35,9 @@ type Stencil struct {
 
 // StencilField describes a field for use with RegisterStencil.
 type StencilField struct {
-	Name string
-	Tag  value.TypeTag
+	Name    string
+	Tag     value.TypeTag
+	Stencil *Stencil
 }
 
 // Field creates a StencilField for use with RegisterStencil.
@@ -33,6 +45,12 @@ func Field(name string, tag value.TypeTag) StencilField {
 	return StencilField{Name: name, Tag: tag}
 }
 
+// Embed creates a StencilField that stores another stencil inline, for use
+// with RegisterStencil.
+func Embed(name string, stencil *Stencil) StencilField {
+	return StencilField{Name: name, Stencil: stencil}
+}
+
 // RegisterStencil registers a named stencil on the compiler so it is
 // available to scripts without a `struct` declaration. Offsets and
 // total size are computed automatically from the field list.
@@ -43,30 +61,49 @@ func Field(name string, tag value.TypeTag) StencilField {
 //	    compiler.Field("active", value.TagBoolean),
 //	    compiler.Field("score", value.TagFloat),
 //	)
+//
+// Fields created with Embed store a previously registered stencil inline:
+//
+//	c.RegisterStencil("entry",
+//	    compiler.Embed("pos", c.LookupStencil("point")),
+//	    compiler.Field("flags", value.TagByte),
+//	)
 func (c *Compiler) RegisterStencil(name string, fields ...StencilField) error {
 	if name == "" {
 		return fmt.Errorf("stencil name cannot be empty")
 	}
+	for _, f := range fields {
+		if f.Stencil == nil && value.SizeForTag(f.Tag) == 0 {
+			return fmt.Errorf("stencil '%s': unknown type tag %d for field '%s'", name, f.Tag, f.Name)
+		}
+	}
+	c.stencils[name] = newStencil(name, fields)
+	return nil
+}
+
+// newStencil lays out the fields contiguously in declaration order. Nested
+// stencils are flattened: they take TotalSize bytes at the field's offset.
+func newStencil(name string, fields []StencilField) *Stencil {
 	stencil := &Stencil{
 		Name:   name,
 		Fields: make([]FieldLayout, 0, len(fields)),
 	}
 	offset := 0
 	for _, f := range fields {
-		size := value.SizeForTag(f.Tag)
-		if size == 0 {
-			return fmt.Errorf("stencil '%s': unknown type tag %d for field '%s'", name, f.Tag, f.Name)
+		field := FieldLayout{
+			Name:    f.Name,
+			Offset:  offset,
+			Tag:     f.Tag,
+			Stencil: f.Stencil,
 		}
-		stencil.Fields = append(stencil.Fields, FieldLayout{
-			Name:   f.Name,
-			Offset: offset,
-			Tag:    f.Tag,
-		})
-		offset += size
+		if f.Stencil != nil {
+			field.Tag = 0
+		}
+		stencil.Fields = append(stencil.Fields, field)
+		offset += field.Size()
 	}
 	stencil.TotalSize = offset
-	c.stencils[name] = stencil
-	return nil
+	return stencil
 }
 
 // LookupStencil returns a registered stencil by name, or nil.
@@ -84,6 +121,27 @@ func (s *Stencil) LookupField(name string) (FieldLayout, bool) {
 	return FieldLayout{}, false
 }
 
+// sameLayout reports whether values of both stencils can be copied and
+// compared byte for byte: same name, same fields at the same offsets.
+func (s *Stencil) sameLayout(other *Stencil) bool {
+	if s == other {
+		return true
+	}
+	if s.Name != other.Name || s.TotalSize != other.TotalSize || len(s.Fields) != len(other.Fields) {
+		return false
+	}
+	for i, f := range s.Fields {
+		o := other.Fields[i]
+		if f.Name != o.Name || f.Offset != o.Offset || f.Tag != o.Tag {
+			return false
+		}
+		if (f.Stencil == nil) != (o.Stencil == nil) || (f.Stencil != nil && !f.Stencil.sameLayout(o.Stencil)) {
+			return false
+		}
+	}
+	return true
+}
+
 // LookupIndex returns the FieldLayout for the given positional index, or false.
 func (s *Stencil) LookupIndex(idx int) (FieldLayout, bool) {
 	if idx < 0 || idx >= len(s.Fields) {
@@ -0,0 +1,91 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/mwantia/vega/pkg/parser"
+	"github.com/mwantia/vega/pkg/value"
+)
+
+// Strings have no fixed size and no bit in the type masks, so string symbols
+// (Tag == value.TagString, Mask == 0) use the STR_* opcodes instead of
+// VAR_ALLOC/VAR_STORE/VAR_LOAD. The helpers below pick the right opcode.
+
+// Accepts reports whether a value of the given tag may be stored in the
+// symbol's slot.
+func (info SymbolInfo) Accepts(tag value.TypeTag) bool {
+	if info.Tag == value.TagString {
+		return tag == value.TagString
+	}
+	return value.TagInMask(tag, info.Mask)
+}
+
+func emitSlotAlloc(b *ByteCode, info SymbolInfo, line int) {
+	if info.Tag == value.TagString {
+		b.Symbol(b.EmitArg(OpStrALLOC, info.SlotID, line), info.Name)
+		return
+	}
+	b.Symbol(b.EmitArgExtra(OpVarALLOC, info.SlotID, info.Mask, line), info.Name)
+}
+
+func emitSlotStore(b *ByteCode, info SymbolInfo, line int) {
+	if info.Tag == value.TagString {
+		b.EmitArg(OpStrSTORE, info.SlotID, line)
+		return
+	}
+	b.EmitArg(OpVarSTORE, info.SlotID, line)
+}
+
+func emitSlotLoad(b *ByteCode, info SymbolInfo, line int) {
+	if info.Tag == value.TagString {
+		b.EmitArg(OpStrLOAD, info.SlotID, line)
+		return
+	}
+	b.EmitArg(OpVarLOAD, info.SlotID, line)
+}
+
+// checkStringAssignment rejects storing a string into a non-string slot and
+// vice versa, which the slot masks cannot express. Expressions whose type
+// cannot be inferred are left to the runtime checks.
+func (c *Compiler) checkStringAssignment(name string, info SymbolInfo, expr parser.Expression) error {
+	tag, err := c.inferTypeTag(expr)
+	if err != nil {
+		return nil
+	}
+	if (info.Tag == value.TagString) == (tag == value.TagString) {
+		return nil
+	}
+	want, _ := value.NameForTag(info.Tag)
+	got, _ := value.NameForTag(tag)
+	return fmt.Errorf("type mismatch: '%s' holds %s, got %s", name, value.NameOrUnknown(want), value.NameOrUnknown(got))
+}
+
+// inferStringInfix returns the result type of a binary operator with at least
+// one string operand: '+' concatenates two strings, comparisons order them.
+func inferStringInfix(operator string, left, right value.TypeTag) (value.TypeTag, error) {
+	if left != value.TagString || right != value.TagString {
+		leftName, _ := value.NameForTag(left)
+		rightName, _ := value.NameForTag(right)
+		return 0, fmt.Errorf("operator '%s' not defined between %s and %s", operator, value.NameOrUnknown(leftName), value.NameOrUnknown(rightName))
+	}
+	if operator == "+" {
+		return value.TagString, nil
+	}
+	if _, ok := comparisonOperations[operator]; ok {
+		return value.TagBoolean, nil
+	}
+	return 0, fmt.Errorf("operator '%s' not defined for string", operator)
+}
+
+// compileInterpolation pushes every part of an interpolated string and emits
+// a single OpStrFORMAT that joins their string forms. Values are formatted by
+// their runtime tag, so a union-typed slot prints whatever it currently holds.
+func (c *Compiler) compileInterpolation(b *ByteCode, e *parser.InterpolatedExpression) error {
+	for _, part := range e.Parts {
+		if err := c.compileExpression(b, part); err != nil {
+			return fmt.Errorf("interpolation '${%s}': %v", part.String(), err)
+		}
+	}
+	b.EmitArg(OpStrFORMAT, len(e.Parts), e.Position().Line)
+	return nil
+}
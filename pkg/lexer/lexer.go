@@ -13,6 +13,9 @@ type Lexer struct {
 	current  rune
 	line     int
 	column   int
+	// pending holds tokens that have already been scanned but not yet
+	// returned by Next, e.g. the parts of an interpolated string.
+	pending []Token
 }
 
 func NewLexer(s string) (*Lexer, error) {
@@ -27,6 +30,21 @@ func NewLexer(s string) (*Lexer, error) {
 	return nil, io.EOF
 }
 
+// NewLexerAt returns a lexer for s whose token positions start at pos instead
+// of line 1, column 1. It is used to lex the expressions embedded in an
+// interpolated string. Offsets remain relative to s.
+func NewLexerAt(s string, pos TokenPosition) (*Lexer, error) {
+	lexer := &Lexer{
+		text:   s,
+		line:   pos.Line,
+		column: pos.Column - 1,
+	}
+	if lexer.ReadChar() {
+		return lexer, nil
+	}
+	return nil, io.EOF
+}
+
 func (l *Lexer) Tokenize() (TokenBuffer, error) {
 	var tokens []Token
 
@@ -93,6 +111,12 @@ func (l *Lexer) Position() TokenPosition {
 }
 
 func (l *Lexer) Next() (Token, error) {
+	if len(l.pending) > 0 {
+		token := l.pending[0]
+		l.pending = l.pending[1:]
+		return token, nil
+	}
+
 	var token Token
 
 	l.SkipWhitespaceAndComments()
@@ -133,10 +157,19 @@ func (l *Lexer) Next() (Token, error) {
 			Position: pos,
 		}
 	case '|':
-		token = Token{
-			Type:     PIPE,
-			Literal:  "|",
-			Position: pos,
+		if l.PeekChar() == '|' {
+			l.ReadChar()
+			token = Token{
+				Type:     OR,
+				Literal:  "||",
+				Position: pos,
+			}
+		} else {
+			token = Token{
+				Type:     PIPE,
+				Literal:  "|",
+				Position: pos,
+			}
 		}
 	case '/':
 		token = Token{
@@ -460,11 +493,18 @@ func (l *Lexer) readCharToken(pos TokenPosition) (Token, error) {
 	}, nil
 }
 
+// ReadStringToken reads a string literal. A string without '${...}' becomes a
+// single STRING token. An interpolated string becomes INTERP_START, followed
+// by INTERP_PART tokens for the literal text and INTERP_EXPR tokens holding
+// the raw source of each embedded expression, and finally INTERP_END. Only
+// INTERP_START is returned; the remaining tokens are queued for Next.
 func (l *Lexer) ReadStringToken(pos TokenPosition) Token {
 	l.ReadChar()
 
 	var result []rune
-	hasInterpolation := false
+	var text []rune
+	var parts []Token
+	textPos := l.Position()
 
 	for {
 		if l.current == 0 {
@@ -482,35 +522,59 @@ func (l *Lexer) ReadStringToken(pos TokenPosition) Token {
 
 		if l.current == '\\' {
 			l.ReadChar()
+			var ch rune
 			switch l.current {
 			case 'n':
-				result = append(result, '\n')
+				ch = '\n'
 			case 't':
-				result = append(result, '\t')
+				ch = '\t'
 			case 'r':
-				result = append(result, '\r')
-			case '\\':
-				result = append(result, '\\')
-			case '"':
-				result = append(result, '"')
-			case '$':
-				result = append(result, '$')
+				ch = '\r'
 			default:
-				result = append(result, l.current)
+				ch = l.current
 			}
+			result = append(result, ch)
+			text = append(text, ch)
 			l.ReadChar()
 			continue
 		}
 
 		if l.current == '$' && l.PeekChar() == '{' {
-			hasInterpolation = true
+			if len(text) > 0 {
+				parts = append(parts, Token{Type: INTERP_PART, Literal: string(text), Position: textPos})
+				text = nil
+			}
+			l.ReadChar() // consume '$'
+			l.ReadChar() // consume '{'
+			exprPos := l.Position()
+			source, ok := l.readInterpolationSource()
+			if !ok {
+				return Token{
+					Type:     ILLEGAL,
+					Literal:  string(result),
+					Position: pos,
+				}
+			}
+			result = append(result, []rune("${"+source+"}")...)
+			parts = append(parts, Token{Type: INTERP_EXPR, Literal: source, Position: exprPos})
+			textPos = l.Position()
+			continue
 		}
 
+		if len(text) == 0 {
+			textPos = l.Position()
+		}
 		result = append(result, l.current)
+		text = append(text, l.current)
 		l.ReadChar()
 	}
 
-	if hasInterpolation {
+	if len(parts) > 0 {
+		if len(text) > 0 {
+			parts = append(parts, Token{Type: INTERP_PART, Literal: string(text), Position: textPos})
+		}
+		parts = append(parts, Token{Type: INTERP_END, Literal: "", Position: l.Position()})
+		l.pending = append(l.pending, parts...)
 		return Token{
 			Type:     INTERP_START,
 			Literal:  string(result),
@@ -524,3 +588,40 @@ func (l *Lexer) ReadStringToken(pos TokenPosition) Token {
 		Position: pos,
 	}
 }
+
+// readInterpolationSource reads the source of an embedded expression up to
+// the matching '}', which is consumed. Braces and string literals inside the
+// expression are skipped, so '${p{x: 1}.x}' and '${f("}")}' work. Returns
+// false if the string or input ends first.
+func (l *Lexer) readInterpolationSource() (string, bool) {
+	start := l.position
+	depth := 0
+	for {
+		switch l.current {
+		case 0, '\n':
+			return "", false
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				source := l.text[start:l.position]
+				l.ReadChar() // consume '}'
+				return source, true
+			}
+			depth--
+		case '"', '\'':
+			quote := l.current
+			l.ReadChar()
+			for l.current != quote {
+				if l.current == 0 || l.current == '\n' {
+					return "", false
+				}
+				if l.current == '\\' {
+					l.ReadChar()
+				}
+				l.ReadChar()
+			}
+		}
+		l.ReadChar()
+	}
+}
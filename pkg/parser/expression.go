@@ -199,7 +199,11 @@ func (i *InterpolatedExpression) Position() lexer.TokenPosition {
 func (i *InterpolatedExpression) String() string {
 	var parts []string
 	for _, p := range i.Parts {
-		parts = append(parts, p.String())
+		if str, ok := p.(*StringExpression); ok {
+			parts = append(parts, str.Value)
+			continue
+		}
+		parts = append(parts, "${"+p.String()+"}")
 	}
 	return "\"" + strings.Join(parts, "") + "\""
 }
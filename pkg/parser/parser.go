@@ -3,12 +3,16 @@ package parser
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"unicode/utf8"
 
 	"github.com/mwantia/vega/pkg/lexer"
 )
 
 type Parser struct {
+	// noStructLiteral disables 'name { ... }' struct literals while parsing
+	// the expression in front of a block, so 'if x {' opens the block.
+	noStructLiteral bool
 }
 
 func NewParser() *Parser {
@@ -60,6 +64,13 @@ func (p *Parser) makeStatement(b lexer.TokenBuffer) (Statement, error) {
 		return p.makeFreeStatement(b)
 	case lexer.STRUCT:
 		return p.makeStructStatement(b)
+	case lexer.IDENT:
+		// 'atomic' is only a keyword right before a block, so variables
+		// named atomic keep working
+		if current.Literal == "atomic" && b.Peek().Type == lexer.LBRACE {
+			return p.makeAtomicStatement(b)
+		}
+		return p.makeExpressionOrAssignment(b)
 	default:
 		return p.makeExpressionOrAssignment(b)
 	}
@@ -72,13 +83,16 @@ func (p *Parser) makeIfStatement(b lexer.TokenBuffer) (*IfStatement, error) {
 	// Consume 'if' token
 	b.Read()
 
-	condition, err := p.makeExpression(b, LOWEST)
+	condition, err := p.makeConditionExpression(b)
 	if err != nil {
 		return nil, fmt.Errorf("empty expression defined for 'if': %v", err)
 	}
+	if condition == nil {
+		return nil, fmt.Errorf("expected condition after 'if' at line %d", statement.Token.Position.Line)
+	}
 	statement.Condition = condition
 
-	if !b.MatchAny(false, lexer.LBRACE) {
+	if !b.MatchAny(true, lexer.LBRACE) {
 		return nil, fmt.Errorf("expected '{', but received '%s'", b.Current().Literal)
 	}
 
@@ -89,7 +103,22 @@ func (p *Parser) makeIfStatement(b lexer.TokenBuffer) (*IfStatement, error) {
 	statement.Consequence = consequence
 	// Match and consume 'else' token
 	if b.MatchAny(true, lexer.ELSE) {
-		if !b.MatchAny(false, lexer.LBRACE) {
+		// 'else if' chains nest the following if statement as the only
+		// statement of the alternative block
+		if b.MatchAny(false, lexer.IF) {
+			token := b.Current()
+			nested, err := p.makeIfStatement(b)
+			if err != nil {
+				return nil, err
+			}
+			statement.Alternative = &BlockStatement{
+				Token:      token,
+				Statements: []Statement{nested},
+			}
+			return statement, nil
+		}
+
+		if !b.MatchAny(true, lexer.LBRACE) {
 			return nil, fmt.Errorf("expected '{', but received '%s'", b.Current().Literal)
 		}
 		alternative, err := p.makeBlockStatement(b)
@@ -101,6 +130,16 @@ func (p *Parser) makeIfStatement(b lexer.TokenBuffer) (*IfStatement, error) {
 	return statement, nil
 }
 
+// makeConditionExpression parses the expression in front of a block, such as
+// 'if x {'. Struct literals are disabled so that the '{' opens the block.
+func (p *Parser) makeConditionExpression(b lexer.TokenBuffer) (Expression, error) {
+	prev := p.noStructLiteral
+	p.noStructLiteral = true
+	defer func() { p.noStructLiteral = prev }()
+
+	return p.makeExpression(b, LOWEST)
+}
+
 func (p *Parser) makeForStatement(b lexer.TokenBuffer) (*ForStatement, error) {
 	statement := &ForStatement{
 		Token: b.Current(),
@@ -148,10 +187,13 @@ func (p *Parser) makeWhileStatement(b lexer.TokenBuffer) (*WhileStatement, error
 	}
 	b.Read()
 
-	condition, err := p.makeExpression(b, LOWEST)
+	condition, err := p.makeConditionExpression(b)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make condition: %v", err)
 	}
+	if condition == nil {
+		return nil, fmt.Errorf("expected condition after 'while' at line %d", statement.Token.Position.Line)
+	}
 	statement.Condition = condition
 
 	if !b.MatchAny(false, lexer.LBRACE) {
@@ -194,11 +236,20 @@ func (p *Parser) makeFunctionStatement(b lexer.TokenBuffer) (*FunctionStatement,
 		return nil, fmt.Errorf("failed to make parameter list: %v", err)
 	}
 	statement.Parameters = params
-	if !b.MatchAny(false, lexer.RPAREN) {
-		return nil, fmt.Errorf("expected ')', but received '%s'", b.Current().Literal)
+
+	// Optional return type: fn name(...): type { ... }
+	if b.MatchAny(true, lexer.COLON) {
+		if !b.MatchAny(false, lexer.IDENT) {
+			return nil, fmt.Errorf("expected return type after ':', but received '%s'", b.Current().Literal)
+		}
+		token := b.Current()
+		statement.ReturnType = &IdentifierExpression{
+			Token: token,
+			Value: token.Literal,
+		}
+		b.Read()
 	}
 
-	b.Read()
 	if !b.MatchAny(false, lexer.LBRACE) {
 		return nil, fmt.Errorf("expected '{', but received '%s'", b.Current().Literal)
 	}
@@ -233,16 +284,24 @@ func (p *Parser) makeParameterList(b lexer.TokenBuffer) ([]*DeclarationExpressio
 		params = append(params, param)
 	}
 
+	if !b.MatchAny(true, lexer.RPAREN) {
+		return nil, fmt.Errorf("expected ')', but received '%s'", b.Current().Literal)
+	}
+
 	return params, nil
 }
 
 func (p *Parser) makeDeclarationExpression(b lexer.TokenBuffer) (*DeclarationExpression, error) {
 	token := b.Current()
+	if token.Type != lexer.IDENT {
+		return nil, fmt.Errorf("expected parameter name, but received '%s'", token.Literal)
+	}
 	expr := &DeclarationExpression{
 		Token:       token,
 		Value:       token.Literal,
 		Constraints: make([]Expression, 0),
 	}
+	b.Read() // consume name
 
 	if b.MatchAny(true, lexer.COLON) {
 		constraint, err := p.makeExpression(b, LOWEST)
@@ -288,8 +347,8 @@ func (p *Parser) makeReturnStatement(b lexer.TokenBuffer) (*ReturnStatement, err
 		Token: b.Current(),
 	}
 	b.Read()
-	// Optional return value
-	if !b.MatchAny(true, lexer.NEWLINE, lexer.RBRACE) && !b.EndReached() {
+	// Optional return value; a closing '}' belongs to the enclosing block
+	if !b.MatchAny(false, lexer.NEWLINE, lexer.SEMICOLON, lexer.RBRACE) && !b.EndReached() {
 		value, err := p.makeExpression(b, LOWEST)
 		if err != nil {
 			return nil, fmt.Errorf("empty expression defined for 'return': %v", err)
@@ -324,11 +383,81 @@ func (p *Parser) makeAllocStatement(b lexer.TokenBuffer) (*AllocStatement, error
 	}
 	b.Read()
 
-	size, err := p.makeExpression(b, LOWEST)
-	if err != nil {
-		return nil, fmt.Errorf("expected size expression after 'alloc': %v", err)
+	// 'auto' in place of the size lets the compiler compute it; a variable
+	// named auto can still be used in a larger size expression
+	if token, next := b.Current(), b.Peek(); token.Type == lexer.IDENT && token.Literal == "auto" &&
+		(next.Type == lexer.LBRACE || next.Type == lexer.COLON || (next.Type == lexer.IDENT && (next.Literal == "grow" || next.Literal == "from"))) {
+		statement.Auto = true
+		b.Read()
+	} else {
+		size, err := p.makeConditionExpression(b)
+		if err != nil {
+			return nil, fmt.Errorf("expected size expression after 'alloc': %v", err)
+		}
+		statement.Size = size
+	}
+
+	// Optional growth ceiling: alloc 64 grow 4096 { ... }
+	if token := b.Current(); token.Type == lexer.IDENT && token.Literal == "grow" {
+		b.Read()
+		ceiling, err := p.makeConditionExpression(b)
+		if err != nil {
+			return nil, fmt.Errorf("expected ceiling expression after 'grow': %v", err)
+		}
+		statement.Grow = ceiling
+	}
+
+	// The persistent arena and the allocator strategy may come in either
+	// order: alloc 64 from "/state/x.arena" :bump { ... }
+	for {
+		// Persistent arena: alloc 4096 from "/state/counter.arena" { ... }
+		if token := b.Current(); token.Type == lexer.IDENT && token.Literal == "from" {
+			if statement.From != nil {
+				return nil, fmt.Errorf("alloc statement has more than one 'from'")
+			}
+			b.Read()
+			if !b.MatchAny(false, lexer.STRING) {
+				return nil, fmt.Errorf("expected path string after 'from', but received '%s'", b.Current().Literal)
+			}
+			token := b.Current()
+			statement.From = &StringExpression{
+				Token: token,
+				Value: token.Literal,
+			}
+			b.Read()
+			continue
+		}
+
+		// Allocator strategy: alloc 64 :bump { ... } or :pool(4)
+		if b.MatchAny(false, lexer.COLON) {
+			if statement.Strategy != nil {
+				return nil, fmt.Errorf("alloc statement has more than one allocator strategy")
+			}
+			b.Read()
+			if !b.MatchAny(false, lexer.IDENT) {
+				return nil, fmt.Errorf("expected allocator strategy after ':', but received '%s'", b.Current().Literal)
+			}
+			token := b.Current()
+			statement.Strategy = &IdentifierExpression{
+				Token: token,
+				Value: token.Literal,
+			}
+			b.Read()
+
+			if b.MatchAny(true, lexer.LPAREN) {
+				arg, err := p.makeExpression(b, LOWEST)
+				if err != nil {
+					return nil, fmt.Errorf("expected argument for allocator strategy '%s': %v", token.Literal, err)
+				}
+				statement.StrategyArg = arg
+				if !b.MatchAny(true, lexer.RPAREN) {
+					return nil, fmt.Errorf("expected ')' after allocator strategy argument, but received '%s'", b.Current().Literal)
+				}
+			}
+			continue
+		}
+		break
 	}
-	statement.Size = size
 
 	if !b.MatchAny(false, lexer.LBRACE) {
 		return nil, fmt.Errorf("expected '{' after alloc size, but received '%s'", b.Current().Literal)
@@ -343,6 +472,33 @@ func (p *Parser) makeAllocStatement(b lexer.TokenBuffer) (*AllocStatement, error
 	return statement, nil
 }
 
+func (p *Parser) makeAtomicStatement(b lexer.TokenBuffer) (*AtomicStatement, error) {
+	statement := &AtomicStatement{
+		Token: b.Current(),
+	}
+	// Consume 'atomic' and '{'
+	b.Read()
+	b.Read()
+
+	body, err := p.makeBlockStatement(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make block statement: %v", err)
+	}
+	statement.Body = body
+
+	if b.MatchAny(true, lexer.ELSE) {
+		if !b.MatchAny(true, lexer.LBRACE) {
+			return nil, fmt.Errorf("expected '{', but received '%s'", b.Current().Literal)
+		}
+		alternative, err := p.makeBlockStatement(b)
+		if err != nil {
+			return nil, fmt.Errorf("empty statement defined for 'else': %v", err)
+		}
+		statement.Alternative = alternative
+	}
+	return statement, nil
+}
+
 func (p *Parser) makeFreeStatement(b lexer.TokenBuffer) (*FreeStatement, error) {
 	statement := &FreeStatement{
 		Token: b.Current(),
@@ -467,6 +623,10 @@ func (p *Parser) makeStructStatement(b lexer.TokenBuffer) (*StructStatement, err
 func (p *Parser) makeArgumentList(b lexer.TokenBuffer) ([]Expression, error) {
 	args := make([]Expression, 0)
 
+	prev := p.noStructLiteral
+	p.noStructLiteral = false
+	defer func() { p.noStructLiteral = prev }()
+
 	if b.MatchAny(true, lexer.RPAREN) {
 		return args, nil
 	}
@@ -519,7 +679,7 @@ func (p *Parser) makePrefixExpression(b lexer.TokenBuffer) (Expression, error) {
 		b.Read()
 
 		// If followed by '{', parse as struct literal: name { field = expr, ... }
-		if b.MatchAny(true, lexer.LBRACE) {
+		if !p.noStructLiteral && b.MatchAny(true, lexer.LBRACE) {
 			return p.makeStructExpression(b, token, identifier.Value)
 		}
 
@@ -578,15 +738,7 @@ func (p *Parser) makePrefixExpression(b lexer.TokenBuffer) (Expression, error) {
 		b.Read()
 		return str, nil
 	case lexer.INTERP_START:
-		// We keep the old token stored in 'token'
-		b.Read()
-
-		parts := make([]Expression, 0)
-		// TODO
-		return &InterpolatedExpression{
-			Token: token,
-			Parts: parts,
-		}, nil
+		return p.makeInterpolatedExpression(b, token)
 	case lexer.TRUE, lexer.FALSE:
 		boolean := &BooleanExpression{
 			Token: token,
@@ -637,6 +789,11 @@ func (p *Parser) makePrefixExpression(b lexer.TokenBuffer) (Expression, error) {
 	case lexer.LPAREN:
 		b.Read()
 
+		// Struct literals are allowed again inside parentheses
+		prev := p.noStructLiteral
+		p.noStructLiteral = false
+		defer func() { p.noStructLiteral = prev }()
+
 		expr, err := p.makeExpression(b, LOWEST)
 		if err != nil {
 			return nil, fmt.Errorf("failed to make group expression: %v", err)
@@ -667,7 +824,7 @@ func (p *Parser) makePrefixExpression(b lexer.TokenBuffer) (Expression, error) {
 			}, nil
 		}
 
-		if !b.MatchAny(false, lexer.RPAREN) {
+		if !b.MatchAny(true, lexer.RPAREN) {
 			return nil, fmt.Errorf("expected ')', but received '%s'", b.Current().Literal)
 		}
 
@@ -693,6 +850,25 @@ func (p *Parser) makePrefixExpression(b lexer.TokenBuffer) (Expression, error) {
 func (p *Parser) makeInfixExpression(b lexer.TokenBuffer, left Expression) (Expression, error) {
 	token := b.Current()
 	switch token.Type {
+	case lexer.PLUS, lexer.MINUS, lexer.ASTERISK, lexer.SLASH, lexer.PERCENT,
+		lexer.EQUAL, lexer.NOT_EQUAL, lexer.LT, lexer.GT, lexer.LTE, lexer.GTE,
+		lexer.AND, lexer.OR:
+		b.Read() // consume operator
+		// Parsing the right side at the operator's own precedence makes
+		// binary operators left-associative: a - b - c == (a - b) - c
+		right, err := p.makeExpression(b, GetTokenPrecedence(token))
+		if err != nil {
+			return nil, fmt.Errorf("failed to make right side of '%s': %v", token.Literal, err)
+		}
+		if right == nil {
+			return nil, fmt.Errorf("expected expression after '%s', but received '%s'", token.Literal, b.Current().Literal)
+		}
+		return &InfixExpression{
+			Token:    token,
+			Left:     left,
+			Operator: token.Literal,
+			Right:    right,
+		}, nil
 	case lexer.LPAREN:
 		b.Read() // consume '('
 		args, err := p.makeArgumentList(b)
@@ -704,6 +880,29 @@ func (p *Parser) makeInfixExpression(b lexer.TokenBuffer, left Expression) (Expr
 			Function:  left,
 			Arguments: args,
 		}, nil
+	case lexer.LBRACKET:
+		b.Read() // consume '['
+
+		// Struct literals are allowed again inside brackets
+		prev := p.noStructLiteral
+		p.noStructLiteral = false
+		defer func() { p.noStructLiteral = prev }()
+
+		index, err := p.makeExpression(b, LOWEST)
+		if err != nil {
+			return nil, fmt.Errorf("failed to make index expression: %v", err)
+		}
+		if index == nil {
+			return nil, fmt.Errorf("expected index expression after '[', but received '%s'", b.Current().Literal)
+		}
+		if !b.MatchAny(true, lexer.RBRACKET) {
+			return nil, fmt.Errorf("expected ']', but received '%s'", b.Current().Literal)
+		}
+		return &IndexExpression{
+			Token: token,
+			Left:  left,
+			Index: index,
+		}, nil
 	case lexer.DOT:
 		b.Read() // consume '.'
 		if !b.MatchAny(false, lexer.IDENT, lexer.INTEGER) {
@@ -745,6 +944,9 @@ func (p *Parser) makeExpressionOrAssignment(b lexer.TokenBuffer) (Statement, err
 	if err != nil {
 		return nil, err
 	}
+	if expr == nil {
+		return nil, fmt.Errorf("unexpected token '%s' at line %d", b.Current().Literal, b.Current().Position.Line)
+	}
 	token := b.Current()
 
 	// Check for typed assignment: ident: type|type = expr
@@ -763,8 +965,17 @@ func (p *Parser) makeExpressionOrAssignment(b lexer.TokenBuffer) (Statement, err
 			constraints = append(constraints, constraint)
 		}
 
+		// Declaration without initial value: ident: type
 		if !b.MatchAny(true, lexer.ASSIGN) {
-			return nil, fmt.Errorf("expected '=' after type constraints, but received '%s'", b.Current().Literal)
+			if !b.EndReached() && !b.MatchAny(false, lexer.NEWLINE, lexer.SEMICOLON, lexer.RBRACE) {
+				return nil, fmt.Errorf("expected '=' after type constraints, but received '%s'", b.Current().Literal)
+			}
+			b.MatchAny(true, lexer.NEWLINE, lexer.SEMICOLON)
+			return &DeclarationStatement{
+				Token:       token,
+				Name:        ident,
+				Constraints: constraints,
+			}, nil
 		}
 
 		value, err := p.makeExpression(b, LOWEST)
@@ -812,6 +1023,13 @@ func (p *Parser) makeExpressionOrAssignment(b lexer.TokenBuffer) (Statement, err
 				Left:  left,
 				Value: value,
 			}, nil
+		case *AttributeExpression:
+			b.MatchAny(true, lexer.NEWLINE, lexer.SEMICOLON)
+			return &FieldAssignmentStatement{
+				Token: token,
+				Left:  left,
+				Value: value,
+			}, nil
 		}
 		return nil, fmt.Errorf("invalid assignment target defined")
 	}
@@ -830,3 +1048,63 @@ func (p *Parser) makeExpressionOrAssignment(b lexer.TokenBuffer) (Statement, err
 	return nil, fmt.Errorf("bare expression statements are not allowed at line %d; use assignment, discard '_ = ...', or function call",
 		expr.Position().Line)
 }
+
+// makeInterpolatedExpression collects the parts of an interpolated string up
+// to INTERP_END. Literal text becomes a StringExpression; the source of every
+// '${...}' is lexed and parsed on its own as a full expression.
+func (p *Parser) makeInterpolatedExpression(b lexer.TokenBuffer, token lexer.Token) (*InterpolatedExpression, error) {
+	b.Read() // consume INTERP_START
+
+	parts := make([]Expression, 0)
+	for !b.MatchAny(true, lexer.INTERP_END) {
+		current := b.Current()
+		switch current.Type {
+		case lexer.INTERP_PART:
+			parts = append(parts, &StringExpression{
+				Token: current,
+				Value: current.Literal,
+			})
+		case lexer.INTERP_EXPR:
+			expr, err := p.makeInterpolationPart(current)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, expr)
+		default:
+			return nil, fmt.Errorf("unexpected token '%s' in interpolated string", current.Type)
+		}
+		b.Read()
+	}
+
+	return &InterpolatedExpression{
+		Token: token,
+		Parts: parts,
+	}, nil
+}
+
+func (p *Parser) makeInterpolationPart(token lexer.Token) (Expression, error) {
+	if strings.TrimSpace(token.Literal) == "" {
+		return nil, fmt.Errorf("empty expression in interpolated string")
+	}
+	lex, err := lexer.NewLexerAt(token.Literal, token.Position)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lex interpolation '${%s}': %v", token.Literal, err)
+	}
+	buffer, err := lex.Tokenize()
+	if err != nil {
+		return nil, fmt.Errorf("failed to lex interpolation '${%s}': %v", token.Literal, err)
+	}
+
+	noStructLiteral := p.noStructLiteral
+	p.noStructLiteral = false
+	defer func() { p.noStructLiteral = noStructLiteral }()
+
+	expr, err := p.makeExpression(buffer, LOWEST)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse interpolation '${%s}': %v", token.Literal, err)
+	}
+	if !buffer.EndReached() {
+		return nil, fmt.Errorf("unexpected token '%s' in interpolation '${%s}'", buffer.Current().Literal, token.Literal)
+	}
+	return expr, nil
+}
@@ -91,6 +91,36 @@ func (as *AssignmentStatement) String() string {
 
 var _ Statement = (*AssignmentStatement)(nil)
 
+// DeclarationStatement declares a typed variable without an initial value,
+// such as 'count: int' or the fixed-size array 'buf: int[64]'.
+type DeclarationStatement struct {
+	Token       lexer.Token
+	Name        *IdentifierExpression
+	Constraints []Expression
+}
+
+func (ds *DeclarationStatement) Statement() {
+
+}
+
+func (ds *DeclarationStatement) Literal() string {
+	return ds.Token.Literal
+}
+
+func (ds *DeclarationStatement) Position() lexer.TokenPosition {
+	return ds.Name.Position()
+}
+
+func (ds *DeclarationStatement) String() string {
+	parts := make([]string, len(ds.Constraints))
+	for i, c := range ds.Constraints {
+		parts[i] = c.String()
+	}
+	return ds.Name.String() + ": " + strings.Join(parts, "|")
+}
+
+var _ Statement = (*DeclarationStatement)(nil)
+
 type IndexAssignmentStatement struct {
 	Token lexer.Token
 	Left  *IndexExpression
@@ -115,6 +145,32 @@ func (ias *IndexAssignmentStatement) String() string {
 
 var _ Statement = (*IndexAssignmentStatement)(nil)
 
+// FieldAssignmentStatement assigns a single field of a struct or tuple, such
+// as 'p.x = 42' or 't.1 = false'.
+type FieldAssignmentStatement struct {
+	Token lexer.Token
+	Left  *AttributeExpression
+	Value Expression
+}
+
+func (fas *FieldAssignmentStatement) Statement() {
+
+}
+
+func (fas *FieldAssignmentStatement) Literal() string {
+	return fas.Token.Literal
+}
+
+func (fas *FieldAssignmentStatement) Position() lexer.TokenPosition {
+	return fas.Left.Position()
+}
+
+func (fas *FieldAssignmentStatement) String() string {
+	return fas.Left.String() + " = " + fas.Value.String()
+}
+
+var _ Statement = (*FieldAssignmentStatement)(nil)
+
 type BlockStatement struct {
 	Token      lexer.Token
 	Statements []Statement
@@ -245,6 +301,7 @@ type FunctionStatement struct {
 	Token      lexer.Token
 	Name       *IdentifierExpression
 	Parameters []*DeclarationExpression
+	ReturnType *IdentifierExpression // nil when omitted
 	Body       *BlockStatement
 }
 
@@ -270,7 +327,12 @@ func (fd *FunctionStatement) String() string {
 		params[i] = p.String()
 	}
 	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") ")
+	out.WriteString(")")
+	if fd.ReturnType != nil {
+		out.WriteString(": ")
+		out.WriteString(fd.ReturnType.String())
+	}
+	out.WriteString(" ")
 	out.WriteString(fd.Body.String())
 	return out.String()
 }
@@ -350,9 +412,14 @@ func (cs *ContinueStatement) String() string {
 var _ Statement = (*ContinueStatement)(nil)
 
 type AllocStatement struct {
-	Token lexer.Token
-	Size  Expression
-	Body  *BlockStatement
+	Token       lexer.Token
+	Size        Expression            // nil when Auto is set
+	Auto        bool                  // 'alloc auto': the compiler computes the size
+	Grow        Expression            // capacity ceiling of a growable arena, nil for a fixed one
+	From        *StringExpression     // VFS path of a persistent arena, nil for one that lives in memory only
+	Strategy    *IdentifierExpression // nil for the default allocator
+	StrategyArg Expression            // argument of the strategy, e.g. the slot size of :pool(4)
+	Body        *BlockStatement
 }
 
 func (as *AllocStatement) Statement() {
@@ -370,14 +437,72 @@ func (as *AllocStatement) Position() lexer.TokenPosition {
 func (as *AllocStatement) String() string {
 	var out strings.Builder
 	out.WriteString("alloc ")
-	out.WriteString(as.Size.String())
+	if as.Auto {
+		out.WriteString("auto")
+	} else {
+		out.WriteString(as.Size.String())
+	}
 	out.WriteString(" ")
+	if as.Grow != nil {
+		out.WriteString("grow ")
+		out.WriteString(as.Grow.String())
+		out.WriteString(" ")
+	}
+	if as.From != nil {
+		out.WriteString("from ")
+		out.WriteString(as.From.String())
+		out.WriteString(" ")
+	}
+	if as.Strategy != nil {
+		out.WriteString(":")
+		out.WriteString(as.Strategy.String())
+		if as.StrategyArg != nil {
+			out.WriteString("(")
+			out.WriteString(as.StrategyArg.String())
+			out.WriteString(")")
+		}
+		out.WriteString(" ")
+	}
 	out.WriteString(as.Body.String())
 	return out.String()
 }
 
 var _ Statement = (*AllocStatement)(nil)
 
+// AtomicStatement runs its body as a transaction: a runtime error inside it
+// restores every arena to its state before the body, and execution continues
+// with the optional else block.
+type AtomicStatement struct {
+	Token       lexer.Token
+	Body        *BlockStatement
+	Alternative *BlockStatement // runs after a rollback, may be nil
+}
+
+func (as *AtomicStatement) Statement() {
+
+}
+
+func (as *AtomicStatement) Literal() string {
+	return as.Token.Literal
+}
+
+func (as *AtomicStatement) Position() lexer.TokenPosition {
+	return as.Token.Position
+}
+
+func (as *AtomicStatement) String() string {
+	var out strings.Builder
+	out.WriteString("atomic ")
+	out.WriteString(as.Body.String())
+	if as.Alternative != nil {
+		out.WriteString(" else ")
+		out.WriteString(as.Alternative.String())
+	}
+	return out.String()
+}
+
+var _ Statement = (*AtomicStatement)(nil)
+
 type FreeStatement struct {
 	Token lexer.Token
 	Name  *IdentifierExpression
@@ -416,6 +416,9 @@ func (m *Model) execute(input string) {
 		m.statusMsg = "Compile error"
 		return
 	}
+	for _, d := range bytecode.Diagnostics {
+		m.addOutput(fmt.Sprintf("warning: %s", d), OutputError, cmdIdx)
+	}
 
 	// Store bytecode for disasm
 	m.lastBytecode = bytecode.Disassemble()
@@ -36,4 +36,8 @@ func (v *BooleanValue) View() []byte {
 	return v.view
 }
 
-var _ Allocable = (*BooleanValue)(nil)
+func (v *BooleanValue) Compare(other Comparable) (int, error) {
+	return compare(v, other)
+}
+
+var _ Comparable = (*BooleanValue)(nil)
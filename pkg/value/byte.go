@@ -34,4 +34,33 @@ func (v *ByteValue) View() []byte {
 	return v.view
 }
 
-var _ Allocable = (*ByteValue)(nil)
+func (v *ByteValue) Compare(other Comparable) (int, error) {
+	return compare(v, other)
+}
+
+func (v *ByteValue) Add(other Numeric) (Numeric, error) {
+	return arithmetic(operationAdd, v, other)
+}
+
+func (v *ByteValue) Sub(other Numeric) (Numeric, error) {
+	return arithmetic(operationSub, v, other)
+}
+
+func (v *ByteValue) Mul(other Numeric) (Numeric, error) {
+	return arithmetic(operationMul, v, other)
+}
+
+func (v *ByteValue) Div(other Numeric) (Numeric, error) {
+	return arithmetic(operationDiv, v, other)
+}
+
+func (v *ByteValue) Mod(other Numeric) (Numeric, error) {
+	return arithmetic(operationMod, v, other)
+}
+
+func (v *ByteValue) Neg() (Numeric, error) {
+	return negate(v)
+}
+
+var _ Numeric = (*ByteValue)(nil)
+var _ Comparable = (*ByteValue)(nil)
@@ -34,4 +34,33 @@ func (v *CharValue) View() []byte {
 	return v.view
 }
 
-var _ Allocable = (*CharValue)(nil)
+func (v *CharValue) Compare(other Comparable) (int, error) {
+	return compare(v, other)
+}
+
+func (v *CharValue) Add(other Numeric) (Numeric, error) {
+	return arithmetic(operationAdd, v, other)
+}
+
+func (v *CharValue) Sub(other Numeric) (Numeric, error) {
+	return arithmetic(operationSub, v, other)
+}
+
+func (v *CharValue) Mul(other Numeric) (Numeric, error) {
+	return arithmetic(operationMul, v, other)
+}
+
+func (v *CharValue) Div(other Numeric) (Numeric, error) {
+	return arithmetic(operationDiv, v, other)
+}
+
+func (v *CharValue) Mod(other Numeric) (Numeric, error) {
+	return arithmetic(operationMod, v, other)
+}
+
+func (v *CharValue) Neg() (Numeric, error) {
+	return negate(v)
+}
+
+var _ Numeric = (*CharValue)(nil)
+var _ Comparable = (*CharValue)(nil)
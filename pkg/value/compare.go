@@ -0,0 +1,83 @@
+package value
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrUnordered is returned by Compare when either operand is NaN.
+// Callers implementing IEEE 754 semantics treat every ordering as false
+// and only inequality as true.
+var ErrUnordered = errors.New("unordered comparison")
+
+// FromBool returns a boolean value backed by a fresh transient buffer.
+func FromBool(v bool) *BooleanValue {
+	if v {
+		return NewBoolean([]byte{1})
+	}
+	return NewBoolean([]byte{0})
+}
+
+// compare orders a and b. Numeric operands are promoted to a common tag
+// first (see Promote), so mixed comparisons like short vs long or int vs
+// decimal compare by value. Booleans only compare with booleans (false < true),
+// strings only with strings (byte-wise lexicographic order).
+func compare(a, b Comparable) (int, error) {
+	ta, tb := TagFor(a), TagFor(b)
+	if ta == TagString || tb == TagString {
+		x, xok := a.(*StringSlice)
+		y, yok := b.(*StringSlice)
+		if !xok || !yok {
+			return 0, fmt.Errorf("cannot compare %s with %s", a.Type(), b.Type())
+		}
+		return bytes.Compare(x.View(), y.View()), nil
+	}
+	if ta == TagBoolean || tb == TagBoolean {
+		x, xok := a.(*BooleanValue)
+		y, yok := b.(*BooleanValue)
+		if !xok || !yok {
+			return 0, fmt.Errorf("cannot compare %s with %s", a.Type(), b.Type())
+		}
+		return cmp.Compare(boolToInt(x.Data()), boolToInt(y.Data())), nil
+	}
+
+	tag, err := Promote(ta, tb)
+	if err != nil {
+		return 0, fmt.Errorf("cannot compare %s with %s", a.Type(), b.Type())
+	}
+
+	if IsFloatTag(tag) {
+		x, err := toFloat64(a)
+		if err != nil {
+			return 0, err
+		}
+		y, err := toFloat64(b)
+		if err != nil {
+			return 0, err
+		}
+		if math.IsNaN(x) || math.IsNaN(y) {
+			return 0, ErrUnordered
+		}
+		return cmp.Compare(x, y), nil
+	}
+
+	x, err := toInt64(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := toInt64(b)
+	if err != nil {
+		return 0, err
+	}
+	return cmp.Compare(x, y), nil
+}
+
+func boolToInt(v bool) int {
+	if v {
+		return 1
+	}
+	return 0
+}
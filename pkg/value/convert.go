@@ -0,0 +1,134 @@
+package value
+
+import (
+	"fmt"
+	"math"
+)
+
+// Convert returns a converted to the given tag. The result is written into a
+// fresh transient buffer; converting to the value's own tag returns a as is.
+//
+//   - integer to integer keeps the low bits (two's complement wrap-around,
+//     300 to byte is 44)
+//   - float or decimal to integer truncates toward zero and saturates at the
+//     bounds of the target (1e10 to int is 2147483647); NaN becomes 0
+//   - integer to float or decimal, and decimal to float, round to the nearest
+//     representable value (ties to even); decimal values beyond the float
+//     range become ±Inf
+//   - bool to a number is 1 or 0, a number to bool is true unless it is 0
+//
+// In strict mode every conversion that does not preserve the value exactly
+// fails instead, e.g. 300 to byte, 2.5 to int or 2 to bool.
+func Convert(a Allocable, to TypeTag, strict bool) (Allocable, error) {
+	from := TagFor(a)
+	if from == to {
+		return a, nil
+	}
+	if !isConvertibleTag(from) || !isConvertibleTag(to) {
+		fromName, _ := NameForTag(from)
+		toName, _ := NameForTag(to)
+		return nil, fmt.Errorf("cannot convert %s to %s", NameOrUnknown(fromName), NameOrUnknown(toName))
+	}
+
+	if from == TagBoolean {
+		var v int64
+		if a.(*BooleanValue).Data() {
+			v = 1
+		}
+		return FromInt64(to, v)
+	}
+
+	if to == TagBoolean {
+		if IsFloatTag(from) {
+			x, _ := toFloat64(a)
+			if strict && x != 0 && x != 1 {
+				return nil, lossyConversion(a, to)
+			}
+			return FromBool(x != 0), nil
+		}
+		i, _ := toInt64(a)
+		if strict && i != 0 && i != 1 {
+			return nil, lossyConversion(a, to)
+		}
+		return FromBool(i != 0), nil
+	}
+
+	if IsFloatTag(to) {
+		if IsFloatTag(from) {
+			x, _ := toFloat64(a)
+			if strict && to == TagFloat && !math.IsNaN(x) && float64(float32(x)) != x {
+				return nil, lossyConversion(a, to)
+			}
+			return FromFloat64(to, x)
+		}
+		i, _ := toInt64(a)
+		x := float64(i)
+		if to == TagFloat {
+			x = float64(float32(x))
+		}
+		if strict && !floatHoldsInt(x, i) {
+			return nil, lossyConversion(a, to)
+		}
+		return FromFloat64(to, x)
+	}
+
+	min, max := integerRange(to)
+	if IsFloatTag(from) {
+		x, _ := toFloat64(a)
+		t := math.Trunc(x)
+		if strict && (math.IsNaN(x) || t != x || t < float64(min) || t >= float64(max)+1) {
+			return nil, lossyConversion(a, to)
+		}
+		switch {
+		case math.IsNaN(t):
+			return FromInt64(to, 0)
+		case t < float64(min):
+			return FromInt64(to, min)
+		case t >= float64(max)+1:
+			// float64(max)+1 is the first value above the range; for long it rounds to 2^63
+			return FromInt64(to, max)
+		default:
+			return FromInt64(to, int64(t))
+		}
+	}
+
+	i, _ := toInt64(a)
+	if strict && (i < min || i > max) {
+		return nil, lossyConversion(a, to)
+	}
+	return FromInt64(to, i)
+}
+
+// isConvertibleTag reports whether Convert accepts values of the tag.
+func isConvertibleTag(tag TypeTag) bool {
+	return IsNumericTag(tag) || tag == TagBoolean
+}
+
+// integerRange returns the smallest and largest value of an integer tag.
+func integerRange(tag TypeTag) (int64, int64) {
+	switch tag {
+	case TagByte:
+		return 0, math.MaxUint8
+	case TagShort:
+		return math.MinInt16, math.MaxInt16
+	case TagInteger, TagChar:
+		return math.MinInt32, math.MaxInt32
+	default:
+		return math.MinInt64, math.MaxInt64
+	}
+}
+
+// floatHoldsInt reports whether x is exactly the integer i.
+func floatHoldsInt(x float64, i int64) bool {
+	// 2^63 is the first float64 above the long range; int64(x) is undefined there
+	if x >= math.MaxInt64 {
+		return false
+	}
+	return int64(x) == i
+}
+
+func lossyConversion(a Allocable, to TypeTag) error {
+	fromName, _ := NameForTag(TagFor(a))
+	toName, _ := NameForTag(to)
+	return fmt.Errorf("lossy conversion from %s %s to %s", fromName, a.String(), toName)
+}
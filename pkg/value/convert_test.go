@@ -0,0 +1,52 @@
+package value_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mwantia/vega/pkg/value"
+)
+
+func TestConvertSaturatesLong(t *testing.T) {
+	for _, tc := range []struct {
+		in   float64
+		want string
+	}{
+		{1e19, "9223372036854775807"},
+		{-1e19, "-9223372036854775808"},
+		{math.Inf(1), "9223372036854775807"},
+		{math.NaN(), "0"},
+	} {
+		in, _ := value.FromFloat64(value.TagDecimal, tc.in)
+		got, err := value.Convert(in, value.TagLong, false)
+		if err != nil {
+			t.Fatalf("Convert(%v, long): %v", tc.in, err)
+		}
+		if got.String() != tc.want {
+			t.Errorf("Convert(%v, long) = %s, want %s", tc.in, got.String(), tc.want)
+		}
+	}
+}
+
+func TestConvertStrict(t *testing.T) {
+	long, _ := value.FromInt64(value.TagLong, math.MaxInt64)
+	if _, err := value.Convert(long, value.TagDecimal, true); err == nil {
+		t.Errorf("Convert(MaxInt64, decimal) in strict mode succeeded, want lossy error")
+	}
+	if _, err := value.Convert(long, value.TagDecimal, false); err != nil {
+		t.Errorf("Convert(MaxInt64, decimal): %v", err)
+	}
+
+	big, _ := value.FromFloat64(value.TagDecimal, 1e300)
+	if _, err := value.Convert(big, value.TagFloat, true); err == nil {
+		t.Errorf("Convert(1e300, float) in strict mode succeeded, want lossy error")
+	}
+
+	nan, _ := value.FromFloat64(value.TagDecimal, math.NaN())
+	if _, err := value.Convert(nan, value.TagFloat, true); err != nil {
+		t.Errorf("Convert(NaN, float) in strict mode: %v", err)
+	}
+	if _, err := value.Convert(nan, value.TagInteger, true); err == nil {
+		t.Errorf("Convert(NaN, int) in strict mode succeeded, want lossy error")
+	}
+}
@@ -38,4 +38,33 @@ func (v *DecimalValue) View() []byte {
 	return v.view
 }
 
-var _ Allocable = (*DecimalValue)(nil)
+func (v *DecimalValue) Compare(other Comparable) (int, error) {
+	return compare(v, other)
+}
+
+func (v *DecimalValue) Add(other Numeric) (Numeric, error) {
+	return arithmetic(operationAdd, v, other)
+}
+
+func (v *DecimalValue) Sub(other Numeric) (Numeric, error) {
+	return arithmetic(operationSub, v, other)
+}
+
+func (v *DecimalValue) Mul(other Numeric) (Numeric, error) {
+	return arithmetic(operationMul, v, other)
+}
+
+func (v *DecimalValue) Div(other Numeric) (Numeric, error) {
+	return arithmetic(operationDiv, v, other)
+}
+
+func (v *DecimalValue) Mod(other Numeric) (Numeric, error) {
+	return arithmetic(operationMod, v, other)
+}
+
+func (v *DecimalValue) Neg() (Numeric, error) {
+	return negate(v)
+}
+
+var _ Numeric = (*DecimalValue)(nil)
+var _ Comparable = (*DecimalValue)(nil)
@@ -40,7 +40,21 @@ func Wrap(tag TypeTag, view []byte) (Allocable, error) {
 		return NewBoolean(view), nil
 	case TagChar:
 		return NewChar(view), nil
+	case TagString:
+		return NewStringView(view), nil
 	default:
 		return nil, fmt.Errorf("unknown type tag: %d", tag)
 	}
 }
+
+// Clone returns a value of the same type backed by a fresh copy of the
+// given value's bytes. Use it when a view must outlive the memory it points into.
+func Clone(a Allocable) Allocable {
+	view := make([]byte, len(a.View()))
+	copy(view, a.View())
+	cloned, err := Wrap(TagFor(a), view)
+	if err != nil {
+		return a
+	}
+	return cloned
+}
@@ -38,4 +38,33 @@ func (v *FloatValue) View() []byte {
 	return v.view
 }
 
-var _ Allocable = (*FloatValue)(nil)
+func (v *FloatValue) Compare(other Comparable) (int, error) {
+	return compare(v, other)
+}
+
+func (v *FloatValue) Add(other Numeric) (Numeric, error) {
+	return arithmetic(operationAdd, v, other)
+}
+
+func (v *FloatValue) Sub(other Numeric) (Numeric, error) {
+	return arithmetic(operationSub, v, other)
+}
+
+func (v *FloatValue) Mul(other Numeric) (Numeric, error) {
+	return arithmetic(operationMul, v, other)
+}
+
+func (v *FloatValue) Div(other Numeric) (Numeric, error) {
+	return arithmetic(operationDiv, v, other)
+}
+
+func (v *FloatValue) Mod(other Numeric) (Numeric, error) {
+	return arithmetic(operationMod, v, other)
+}
+
+func (v *FloatValue) Neg() (Numeric, error) {
+	return negate(v)
+}
+
+var _ Numeric = (*FloatValue)(nil)
+var _ Comparable = (*FloatValue)(nil)
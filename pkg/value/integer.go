@@ -22,8 +22,7 @@ func (v *IntegerValue) Type() string {
 }
 
 func (v *IntegerValue) String() string {
-	dat := binary.LittleEndian.Uint32(v.view)
-	return strconv.FormatUint(uint64(dat), 10)
+	return strconv.FormatInt(int64(v.Data()), 10)
 }
 
 func (v *IntegerValue) Size() byte {
@@ -38,4 +37,33 @@ func (v *IntegerValue) View() []byte {
 	return v.view
 }
 
-var _ Allocable = (*IntegerValue)(nil)
+func (v *IntegerValue) Compare(other Comparable) (int, error) {
+	return compare(v, other)
+}
+
+func (v *IntegerValue) Add(other Numeric) (Numeric, error) {
+	return arithmetic(operationAdd, v, other)
+}
+
+func (v *IntegerValue) Sub(other Numeric) (Numeric, error) {
+	return arithmetic(operationSub, v, other)
+}
+
+func (v *IntegerValue) Mul(other Numeric) (Numeric, error) {
+	return arithmetic(operationMul, v, other)
+}
+
+func (v *IntegerValue) Div(other Numeric) (Numeric, error) {
+	return arithmetic(operationDiv, v, other)
+}
+
+func (v *IntegerValue) Mod(other Numeric) (Numeric, error) {
+	return arithmetic(operationMod, v, other)
+}
+
+func (v *IntegerValue) Neg() (Numeric, error) {
+	return negate(v)
+}
+
+var _ Numeric = (*IntegerValue)(nil)
+var _ Comparable = (*IntegerValue)(nil)
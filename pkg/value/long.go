@@ -37,4 +37,33 @@ func (v *LongValue) View() []byte {
 	return v.view
 }
 
-var _ Allocable = (*LongValue)(nil)
+func (v *LongValue) Compare(other Comparable) (int, error) {
+	return compare(v, other)
+}
+
+func (v *LongValue) Add(other Numeric) (Numeric, error) {
+	return arithmetic(operationAdd, v, other)
+}
+
+func (v *LongValue) Sub(other Numeric) (Numeric, error) {
+	return arithmetic(operationSub, v, other)
+}
+
+func (v *LongValue) Mul(other Numeric) (Numeric, error) {
+	return arithmetic(operationMul, v, other)
+}
+
+func (v *LongValue) Div(other Numeric) (Numeric, error) {
+	return arithmetic(operationDiv, v, other)
+}
+
+func (v *LongValue) Mod(other Numeric) (Numeric, error) {
+	return arithmetic(operationMod, v, other)
+}
+
+func (v *LongValue) Neg() (Numeric, error) {
+	return negate(v)
+}
+
+var _ Numeric = (*LongValue)(nil)
+var _ Comparable = (*LongValue)(nil)
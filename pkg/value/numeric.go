@@ -0,0 +1,257 @@
+package value
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// arithmeticOperation selects the operator applied by arithmetic.
+type arithmeticOperation byte
+
+const (
+	operationAdd arithmeticOperation = iota
+	operationSub
+	operationMul
+	operationDiv
+	operationMod
+)
+
+// IsNumericTag reports whether values of the given tag support arithmetic.
+// Every primitive except boolean is numeric; char and byte behave as integers.
+func IsNumericTag(tag TypeTag) bool {
+	switch tag {
+	case TagShort, TagInteger, TagLong, TagFloat, TagDecimal, TagByte, TagChar:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsFloatTag reports whether the tag is a floating-point type (float or decimal).
+func IsFloatTag(tag TypeTag) bool {
+	return tag == TagFloat || tag == TagDecimal
+}
+
+// integerRank orders the integer tags by width. Char ranks alongside int
+// because both are 32-bit signed values.
+func integerRank(tag TypeTag) int {
+	switch tag {
+	case TagByte:
+		return 1
+	case TagShort:
+		return 2
+	case TagInteger, TagChar:
+		return 3
+	case TagLong:
+		return 4
+	default:
+		return 0
+	}
+}
+
+// Promote returns the result tag of a binary operation between two numeric tags:
+//
+//   - identical tags keep their tag (byte+byte is byte, char+char is char)
+//   - decimal wins over everything
+//   - float wins over the integer tags, except long, which promotes to decimal
+//     because a float32 cannot hold the long range
+//   - between integers the wider tag wins (byte < short < int < long); char
+//     mixed with another integer behaves as int
+func Promote(a, b TypeTag) (TypeTag, error) {
+	if !IsNumericTag(a) || !IsNumericTag(b) {
+		left, _ := NameForTag(a)
+		right, _ := NameForTag(b)
+		return 0, fmt.Errorf("operation not defined between %s and %s", NameOrUnknown(left), NameOrUnknown(right))
+	}
+	if a == b {
+		return a, nil
+	}
+	if a == TagDecimal || b == TagDecimal {
+		return TagDecimal, nil
+	}
+	if a == TagFloat || b == TagFloat {
+		if a == TagLong || b == TagLong {
+			return TagDecimal, nil
+		}
+		return TagFloat, nil
+	}
+	if integerRank(a) == integerRank(b) {
+		// int mixed with char
+		return TagInteger, nil
+	}
+	if integerRank(a) > integerRank(b) {
+		if a == TagChar {
+			return TagInteger, nil
+		}
+		return a, nil
+	}
+	if b == TagChar {
+		return TagInteger, nil
+	}
+	return b, nil
+}
+
+// FromInt64 encodes v into a fresh transient buffer of the given numeric tag.
+// Integer tags keep the low bits of v (two's complement wrap-around),
+// float tags receive the nearest representable value.
+func FromInt64(tag TypeTag, v int64) (Numeric, error) {
+	switch tag {
+	case TagByte:
+		return NewByte([]byte{byte(v)}), nil
+	case TagShort:
+		view := make([]byte, 2)
+		binary.LittleEndian.PutUint16(view, uint16(v))
+		return NewShort(view), nil
+	case TagInteger:
+		view := make([]byte, 4)
+		binary.LittleEndian.PutUint32(view, uint32(v))
+		return NewInteger(view), nil
+	case TagChar:
+		view := make([]byte, 4)
+		binary.LittleEndian.PutUint32(view, uint32(v))
+		return NewChar(view), nil
+	case TagLong:
+		view := make([]byte, 8)
+		binary.LittleEndian.PutUint64(view, uint64(v))
+		return NewLong(view), nil
+	case TagFloat, TagDecimal:
+		return FromFloat64(tag, float64(v))
+	default:
+		return nil, fmt.Errorf("type tag %d is not numeric", tag)
+	}
+}
+
+// FromFloat64 encodes v into a fresh transient buffer of the given numeric tag.
+// Integer tags truncate v toward zero before wrapping to their width.
+func FromFloat64(tag TypeTag, v float64) (Numeric, error) {
+	switch tag {
+	case TagFloat:
+		view := make([]byte, 4)
+		binary.LittleEndian.PutUint32(view, math.Float32bits(float32(v)))
+		return NewFloat(view), nil
+	case TagDecimal:
+		view := make([]byte, 8)
+		binary.LittleEndian.PutUint64(view, math.Float64bits(v))
+		return NewDecimal(view), nil
+	default:
+		return FromInt64(tag, int64(v))
+	}
+}
+
+// toInt64 returns the integer content of an integer-tagged value.
+// Byte is unsigned; every other integer tag is sign-extended.
+func toInt64(a Allocable) (int64, error) {
+	switch v := a.(type) {
+	case *ByteValue:
+		return int64(v.Data()), nil
+	case *ShortValue:
+		return int64(v.Data()), nil
+	case *IntegerValue:
+		return int64(v.Data()), nil
+	case *CharValue:
+		return int64(v.Data()), nil
+	case *LongValue:
+		return v.Data(), nil
+	default:
+		return 0, fmt.Errorf("%s is not an integer", a.Type())
+	}
+}
+
+// toFloat64 returns the content of any numeric value as float64.
+func toFloat64(a Allocable) (float64, error) {
+	switch v := a.(type) {
+	case *FloatValue:
+		return float64(v.Data()), nil
+	case *DecimalValue:
+		return v.Data(), nil
+	default:
+		i, err := toInt64(a)
+		return float64(i), err
+	}
+}
+
+// arithmetic applies op to a and b after promoting both to a common tag.
+// The result is written into a transient buffer and never aliases either operand.
+func arithmetic(op arithmeticOperation, a, b Numeric) (Numeric, error) {
+	tag, err := Promote(TagFor(a), TagFor(b))
+	if err != nil {
+		return nil, err
+	}
+
+	if IsFloatTag(tag) {
+		x, err := toFloat64(a)
+		if err != nil {
+			return nil, err
+		}
+		y, err := toFloat64(b)
+		if err != nil {
+			return nil, err
+		}
+		var result float64
+		switch op {
+		case operationAdd:
+			result = x + y
+		case operationSub:
+			result = x - y
+		case operationMul:
+			result = x * y
+		case operationDiv:
+			// IEEE 754 semantics: division by zero yields ±Inf or NaN
+			result = x / y
+		case operationMod:
+			result = math.Mod(x, y)
+		}
+		if tag == TagFloat {
+			result = float64(float32(result))
+		}
+		return FromFloat64(tag, result)
+	}
+
+	x, err := toInt64(a)
+	if err != nil {
+		return nil, err
+	}
+	y, err := toInt64(b)
+	if err != nil {
+		return nil, err
+	}
+	var result int64
+	switch op {
+	case operationAdd:
+		result = x + y
+	case operationSub:
+		result = x - y
+	case operationMul:
+		result = x * y
+	case operationDiv:
+		if y == 0 {
+			return nil, fmt.Errorf("integer division by zero")
+		}
+		result = x / y
+	case operationMod:
+		if y == 0 {
+			return nil, fmt.Errorf("integer modulo by zero")
+		}
+		result = x % y
+	}
+	return FromInt64(tag, result)
+}
+
+// negate returns -a in a transient buffer of the same tag.
+// Unsigned bytes wrap around (-1b is 255b).
+func negate(a Numeric) (Numeric, error) {
+	tag := TagFor(a)
+	if IsFloatTag(tag) {
+		x, err := toFloat64(a)
+		if err != nil {
+			return nil, err
+		}
+		return FromFloat64(tag, -x)
+	}
+	x, err := toInt64(a)
+	if err != nil {
+		return nil, err
+	}
+	return FromInt64(tag, -x)
+}
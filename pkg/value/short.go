@@ -37,4 +37,33 @@ func (v *ShortValue) View() []byte {
 	return v.view
 }
 
-var _ Allocable = (*ShortValue)(nil)
+func (v *ShortValue) Compare(other Comparable) (int, error) {
+	return compare(v, other)
+}
+
+func (v *ShortValue) Add(other Numeric) (Numeric, error) {
+	return arithmetic(operationAdd, v, other)
+}
+
+func (v *ShortValue) Sub(other Numeric) (Numeric, error) {
+	return arithmetic(operationSub, v, other)
+}
+
+func (v *ShortValue) Mul(other Numeric) (Numeric, error) {
+	return arithmetic(operationMul, v, other)
+}
+
+func (v *ShortValue) Div(other Numeric) (Numeric, error) {
+	return arithmetic(operationDiv, v, other)
+}
+
+func (v *ShortValue) Mod(other Numeric) (Numeric, error) {
+	return arithmetic(operationMod, v, other)
+}
+
+func (v *ShortValue) Neg() (Numeric, error) {
+	return negate(v)
+}
+
+var _ Numeric = (*ShortValue)(nil)
+var _ Comparable = (*ShortValue)(nil)
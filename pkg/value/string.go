@@ -0,0 +1,139 @@
+package value
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// StringPrefixSize is the size of the little-endian uint32 length prefix that
+// precedes the bytes of a string stored in the alloc buffer.
+const StringPrefixSize = 4
+
+// StringSlice is an immutable UTF-8 string. The view holds only the string
+// bytes, so it can point into the constants table, into a string slot of the
+// alloc buffer (behind its length prefix) or into a transient buffer.
+// Substrings share the view of their parent.
+type StringSlice struct {
+	view []byte
+}
+
+// NewString returns a string backed by a fresh copy of v.
+func NewString(v string) *StringSlice {
+	return &StringSlice{
+		view: []byte(v),
+	}
+}
+
+// NewStringView returns a string that views the given UTF-8 bytes. No data is copied.
+func NewStringView(view []byte) *StringSlice {
+	return &StringSlice{
+		view: view,
+	}
+}
+
+func (v *StringSlice) Type() string {
+	return "string"
+}
+
+func (v *StringSlice) String() string {
+	return string(v.view)
+}
+
+// Size returns 0: strings have no fixed size. Use Length for the byte count.
+func (v *StringSlice) Size() byte {
+	return 0
+}
+
+func (v *StringSlice) Data() string {
+	return string(v.view)
+}
+
+func (v *StringSlice) View() []byte {
+	return v.view
+}
+
+func (v *StringSlice) Compare(other Comparable) (int, error) {
+	return compare(v, other)
+}
+
+// Length returns the number of bytes in the string.
+func (v *StringSlice) Length() int {
+	return len(v.view)
+}
+
+// Index returns the byte at the given position as a view into the string.
+func (v *StringSlice) Index(key Value) (Value, error) {
+	i, err := stringIndex(key)
+	if err != nil {
+		return nil, err
+	}
+	if i < 0 || i >= len(v.view) {
+		return nil, fmt.Errorf("index %d out of bounds for string of length %d", i, len(v.view))
+	}
+	return NewByte(v.view[i : i+1]), nil
+}
+
+// SetIndex always fails: strings are immutable.
+func (v *StringSlice) SetIndex(key Value, val Value) error {
+	return fmt.Errorf("strings are immutable")
+}
+
+// Iterator yields the characters of the string. Invalid UTF-8 sequences
+// yield utf8.RuneError, one byte at a time.
+func (v *StringSlice) Iterator() Iterator {
+	return &stringIterator{view: v.view}
+}
+
+// Slice returns the substring of length bytes starting at start. The result
+// shares its view with v.
+func (v *StringSlice) Slice(start, length int) (Slice, error) {
+	if start < 0 || length < 0 || start+length > len(v.view) {
+		return nil, fmt.Errorf("slice [%d:%d] out of bounds for string of length %d", start, start+length, len(v.view))
+	}
+	return NewStringView(v.view[start : start+length]), nil
+}
+
+// Alloc returns a copy of the string that no longer shares its view.
+func (v *StringSlice) Alloc() (Allocable, error) {
+	return NewStringView(bytes.Clone(v.view)), nil
+}
+
+// Concat returns a new string holding v followed by other.
+func (v *StringSlice) Concat(other *StringSlice) *StringSlice {
+	view := make([]byte, 0, len(v.view)+len(other.view))
+	view = append(view, v.view...)
+	view = append(view, other.view...)
+	return NewStringView(view)
+}
+
+func stringIndex(key Value) (int, error) {
+	alloc, ok := key.(Allocable)
+	if !ok {
+		return 0, fmt.Errorf("string index must be an integer, got %s", key.Type())
+	}
+	return ToInt(alloc)
+}
+
+type stringIterator struct {
+	view    []byte
+	current rune
+}
+
+func (it *stringIterator) Next() bool {
+	if len(it.view) == 0 {
+		return false
+	}
+	r, size := utf8.DecodeRune(it.view)
+	it.current = r
+	it.view = it.view[size:]
+	return true
+}
+
+func (it *stringIterator) Value() Value {
+	v, _ := FromInt64(TagChar, int64(it.current))
+	return v
+}
+
+var _ Comparable = (*StringSlice)(nil)
+var _ Slice = (*StringSlice)(nil)
@@ -12,6 +12,13 @@ const (
 	TagBoolean TypeTag = 6 // bool, 1 byte
 	TagByte    TypeTag = 7 // uint8, 1 byte
 	TagChar    TypeTag = 8 // rune, 4 bytes
+
+	// TagLastMasked is the highest tag with a bit in the 8-bit type masks.
+	TagLastMasked = TagChar
+
+	// TagString marks variable-size UTF-8 strings. It lies outside the
+	// 8-bit type masks, so a string slot can never be part of a union.
+	TagString TypeTag = 9
 )
 
 // TagFor returns the TypeTag for an Allocable value.
@@ -33,6 +40,8 @@ func TagFor(a Allocable) TypeTag {
 		return TagByte
 	case *CharValue:
 		return TagChar
+	case *StringSlice:
+		return TagString
 	default:
 		return 0
 	}
@@ -57,6 +66,8 @@ func TagForName(name string) (TypeTag, bool) {
 		return TagByte, true
 	case "char":
 		return TagChar, true
+	case "string":
+		return TagString, true
 	default:
 		return 0, false
 	}
@@ -80,15 +91,26 @@ func NameForTag(tag TypeTag) (string, bool) {
 		return "byte", true
 	case TagChar:
 		return "char", true
+	case TagString:
+		return "string", true
 	default:
 		return "", false
 	}
 }
 
+// NameOrUnknown returns name, a result of NameForTag, or "unknown" when the
+// tag had no name.
+func NameOrUnknown(name string) string {
+	if name == "" {
+		return "unknown"
+	}
+	return name
+}
+
 // MaskForTag returns a bitmask with the bit for the given tag set.
 // Tags 1–8 map to bits 0–7.
 func MaskForTag(tag TypeTag) byte {
-	if tag < 1 || tag > 8 {
+	if tag < 1 || tag > TagLastMasked {
 		return 0
 	}
 	return 1 << (tag - 1)
@@ -102,7 +124,7 @@ func TagInMask(tag TypeTag, mask byte) bool {
 // MaxSizeForMask returns the maximum byte size across all tags in the mask.
 func MaxSizeForMask(mask byte) int {
 	maxSize := 0
-	for t := TypeTag(1); t <= 8; t++ {
+	for t := TypeTag(1); t <= TagLastMasked; t++ {
 		if mask&(1<<(t-1)) != 0 {
 			if s := SizeForTag(t); s > maxSize {
 				maxSize = s
@@ -113,6 +135,7 @@ func MaxSizeForMask(mask byte) int {
 }
 
 // SizeForTag returns the byte size for the given TypeTag.
+// Strings have no fixed size and report 0.
 func SizeForTag(tag TypeTag) int {
 	switch tag {
 	case TagShort:
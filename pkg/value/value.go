@@ -9,24 +9,6 @@ type Value interface {
 	String() string
 }
 
-// --- Slice value ---
-
-// StringSlice holds a reference to string data in static VM memory (constants table).
-// Implements Value only for now; Slice interface will be added when indexing/iteration is needed.
-type StringSlice struct {
-	data string
-}
-
-func NewString(v string) *StringSlice {
-	return &StringSlice{data: v}
-}
-
-func (v *StringSlice) Type() string   { return "string" }
-func (v *StringSlice) String() string { return v.data }
-func (v *StringSlice) Data() string   { return v.data }
-
-var _ Value = (*StringSlice)(nil)
-
 // --- Nil ---
 
 // NilValue is a singleton sentinel. Not allocable, not a slice.
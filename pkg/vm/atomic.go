@@ -0,0 +1,86 @@
+package vm
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Snapshot is the state saved when an atomic block begins: a copy of every
+// arena's allocator, buffer and shadow, and of the slot table. Rolling back
+// puts it back exactly; committing drops it.
+type Snapshot struct {
+	arenas  []Arena
+	slots   []SlotEntry
+	depth   int  // length of the expression stack
+	frame   int  // index of the call frame running the block
+	resume  int  // address to continue at after a rollback
+	line    int  // source line of the atomic block
+	handled bool // an else block handles the rollback, so it is not reported
+}
+
+// snapshot saves the state of all arenas for the atomic block at line.
+func (r *Runtime) snapshot(resume, line int, handled bool) error {
+	if len(r.arenas) == 0 {
+		return fmt.Errorf("no allocator active")
+	}
+	arenas := slices.Clone(r.arenas)
+	for i := range arenas {
+		arenas[i].allocator = arenas[i].allocator.Clone()
+		arenas[i].shadow = slices.Clone(arenas[i].shadow)
+	}
+	r.snapshots = append(r.snapshots, Snapshot{
+		arenas:  arenas,
+		slots:   slices.Clone(r.slots),
+		depth:   r.exprStack.Len(),
+		frame:   r.Index,
+		resume:  resume,
+		line:    line,
+		handled: handled,
+	})
+	return nil
+}
+
+// commit drops the state saved by the innermost atomic block.
+func (r *Runtime) commit() error {
+	if len(r.snapshots) == 0 {
+		return fmt.Errorf("no atomic block active")
+	}
+	r.snapshots = r.snapshots[:len(r.snapshots)-1]
+	return nil
+}
+
+// rollback restores the state saved by the innermost atomic block after err
+// and resumes after the block, leaving the functions called from inside it.
+// It reports false when no atomic block is open, so err ends the program.
+// Output written and natives called inside the block are not undone.
+func (r *Runtime) rollback(err error) bool {
+	n := len(r.snapshots)
+	if n == 0 {
+		return false
+	}
+	saved := r.snapshots[n-1]
+	r.snapshots = r.snapshots[:n-1]
+
+	for i := r.Index; i > saved.frame; i-- {
+		r.Frames[i] = nil
+	}
+	r.Index = saved.frame
+
+	// Values pushed before the block may view the current buffers
+	r.exprStack.data = r.exprStack.data[:min(saved.depth, r.exprStack.Len())]
+	for i, arena := range saved.arenas {
+		current := r.arenas[i].allocator
+		r.rebase(current.Slice(0, current.Capacity()), arena.allocator.Slice(0, arena.allocator.Capacity()), func(offset int) int {
+			return offset
+		})
+	}
+	r.arenas = saved.arenas
+	r.allocator = r.arenas[len(r.arenas)-1].allocator
+	r.slots = saved.slots
+
+	r.IndexedFrame().InstructionPointer = saved.resume
+	if !saved.handled {
+		fmt.Fprintf(r.native.Stderr, "warning: line %d: atomic block rolled back: %v\n", saved.line, err)
+	}
+	return true
+}
@@ -18,6 +18,26 @@ type VirtualMachine interface {
 	// Stderr returns and/or sets the currently used writer to output stderr messages.
 	Stderr(io.Writer) io.Writer
 
+	// MaxAllocSize returns and/or sets the limit in bytes for the combined
+	// capacity of all live alloc blocks. Values <= 0 leave it unchanged.
+	MaxAllocSize(int) int
+
+	// OnArenaGrowth sets a callback that is invoked every time a growable
+	// alloc block reallocates its buffer. nil removes it.
+	OnArenaGrowth(func(ArenaGrowth))
+
+	// SetSanitize enables shadow memory that tracks which slot owns every
+	// allocator byte, so pointer alias loads and stores of freed or unowned
+	// bytes, and alias stores across two slots, fail. It is meant for
+	// debugging and slows down every allocation.
+	SetSanitize(bool)
+
+	// SetLeakCheck enables a report of the slots an alloc block still holds
+	// when it exits, with their names, sizes and allocation lines. It is
+	// written to stderr as a warning, or fails the run for code compiled
+	// in strict mode.
+	SetLeakCheck(bool)
+
 	// Run executes bytecode and returns the exit code.
 	Run(context.Context, *compiler.ByteCode) (int, error)
 }
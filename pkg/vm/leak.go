@@ -0,0 +1,35 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mwantia/vega/pkg/compiler"
+)
+
+// leaks describes the live slots that still own memory in the innermost
+// arena, or returns "" when there are none. Names come from the debug
+// symbols of bytecode, which allocated every slot of the block since
+// functions release their locals on return.
+func (r *Runtime) leaks(bytecode *compiler.ByteCode) string {
+	n := len(r.arenas)
+	if n == 0 {
+		return ""
+	}
+	var leaked []string
+	for id := r.arenas[n-1].base; id < len(r.slots); id++ {
+		slot := r.slots[id]
+		if !slot.Alive || slot.Alias || slot.Size == 0 || slot.Arena != n-1 {
+			continue
+		}
+		name := fmt.Sprintf("slot %d", id)
+		if symbol, ok := bytecode.Symbols[slot.Site]; ok {
+			name = fmt.Sprintf("'%s'", symbol)
+		}
+		leaked = append(leaked, fmt.Sprintf("%s (%d bytes, allocated at line %d)", name, slot.Size, slot.Line))
+	}
+	if len(leaked) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("alloc block exits with %d leaked slots: %s", len(leaked), strings.Join(leaked, ", "))
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
+	"github.com/mwantia/vega/pkg/compiler"
 	"github.com/mwantia/vega/pkg/value"
 	"github.com/mwantia/vfs"
 )
@@ -18,16 +20,19 @@ type Native struct {
 }
 
 // NativeFunc is the signature for all native (Go-implemented) functions
-// callable from Vega via OpCallNAT. Native functions are void — they do not
-// push a return value onto the expression stack.
-type NativeFunc func(nat *Native, args []value.Value) error
+// callable from Vega via OpCallNAT. The returned values are pushed onto the
+// expression stack in order; their number and types must match the return
+// types declared in RegisterNative.
+type NativeFunc func(nat *Native, args []value.Value) ([]value.Value, error)
 
 var nativeRegistry = map[string]NativeFunc{}
 
-// RegisterNative registers a native function under the given name.
-// Call this before running any bytecode that references the function.
-func RegisterNative(name string, fn NativeFunc) {
+// RegisterNative registers a native function under the given name together
+// with the types of the values it returns. Call this before compiling any
+// source that references the function, so the compiler knows its signature.
+func RegisterNative(name string, fn NativeFunc, returns ...value.TypeTag) {
 	nativeRegistry[name] = fn
+	compiler.RegisterNativeSignature(name, returns...)
 }
 
 // lookupNative returns the native function registered under name, if any.
@@ -39,21 +44,34 @@ func lookupNative(name string) (NativeFunc, bool) {
 func init() {
 	RegisterNative("print", nativePrint)
 	RegisterNative("type", nativeType)
+	RegisterNative("clock", nativeClock, value.TagLong)
 }
 
-func nativePrint(nat *Native, args []value.Value) error {
+func nativePrint(nat *Native, args []value.Value) ([]value.Value, error) {
 	parts := make([]string, len(args))
 	for i, arg := range args {
 		parts[i] = arg.String()
 	}
 	_, err := fmt.Fprintln(nat.Stdout, strings.Join(parts, " "))
-	return err
+	return nil, err
 }
 
-func nativeType(nat *Native, args []value.Value) error {
+func nativeType(nat *Native, args []value.Value) ([]value.Value, error) {
 	if len(args) != 1 {
-		return fmt.Errorf("type expects 1 argument, got %d", len(args))
+		return nil, fmt.Errorf("type expects 1 argument, got %d", len(args))
 	}
 	_, err := fmt.Fprintf(nat.Stdout, "(%s)\n", args[0].Type())
-	return err
+	return nil, err
+}
+
+// nativeClock returns the current Unix time in milliseconds.
+func nativeClock(nat *Native, args []value.Value) ([]value.Value, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("clock expects 0 arguments, got %d", len(args))
+	}
+	result, err := value.FromInt64(value.TagLong, time.Now().UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	return []value.Value{result}, nil
 }
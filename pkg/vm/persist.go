@@ -0,0 +1,222 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"path"
+
+	"github.com/mwantia/vega/pkg/compiler"
+	"github.com/mwantia/vega/pkg/value"
+)
+
+// A persistent arena is saved to its file as a header, one record per live
+// slot and the encoded allocator. Slot IDs are relative to the first slot of
+// the block, so the enclosing blocks may change between runs; the layout
+// fingerprint guards everything else.
+
+var arenaMagic = [4]byte{'V', 'G', 'A', 'R'}
+
+const arenaVersion = 1
+
+type arenaHeader struct {
+	Magic       [4]byte
+	Version     uint16
+	Fingerprint uint64
+	Slots       uint32
+}
+
+type arenaSlot struct {
+	ID      uint32 // relative to the block's first slot
+	Offset  uint32
+	Size    uint32
+	Length  uint32
+	Tag     value.TypeTag
+	Mask    byte
+	Stencil bool
+}
+
+// load fills the arena at index, which was just entered, from the file of
+// its persistent block. Without a file the arena starts empty and the file
+// is created on exit. The slots of the file are restored as live but
+// unclaimed, see claim.
+func (r *Runtime) load(index int, persistent *compiler.PersistentArena) error {
+	arena := &r.arenas[index]
+	arena.persistent = persistent
+	if r.native.FS == nil {
+		return fmt.Errorf("persistent arena '%s' needs a file system", persistent.Path)
+	}
+
+	exists, err := r.native.FS.LookupMetadata(r.ctx, persistent.Path)
+	if err != nil {
+		return fmt.Errorf("persistent arena '%s': %w", persistent.Path, err)
+	}
+	if !exists {
+		return nil
+	}
+	meta, err := r.native.FS.StatMetadata(r.ctx, persistent.Path)
+	if err != nil {
+		return fmt.Errorf("persistent arena '%s': %w", persistent.Path, err)
+	}
+	data, err := r.native.FS.ReadFile(r.ctx, persistent.Path, 0, meta.Size)
+	if err != nil {
+		return fmt.Errorf("persistent arena '%s': %w", persistent.Path, err)
+	}
+
+	reader := bytes.NewReader(data)
+	var header arenaHeader
+	if err := binary.Read(reader, binary.LittleEndian, &header); err != nil || header.Magic != arenaMagic {
+		return fmt.Errorf("persistent arena '%s' is not an arena file", persistent.Path)
+	}
+	if header.Version != arenaVersion {
+		return fmt.Errorf("persistent arena '%s' has version %d, want %d", persistent.Path, header.Version, arenaVersion)
+	}
+	if header.Fingerprint != persistent.Fingerprint {
+		return fmt.Errorf("persistent arena '%s' was saved with layout %016x, but the block has layout %016x; its variables, their types or the allocator changed",
+			persistent.Path, header.Fingerprint, persistent.Fingerprint)
+	}
+	if int(header.Slots) > reader.Len() {
+		return fmt.Errorf("persistent arena '%s' is truncated", persistent.Path)
+	}
+	saved := make([]arenaSlot, header.Slots)
+	if err := binary.Read(reader, binary.LittleEndian, saved); err != nil {
+		return fmt.Errorf("persistent arena '%s' is truncated", persistent.Path)
+	}
+
+	// The capacity of the block is a minimum; a saved arena that grew keeps
+	// its size
+	size := arena.allocator.Capacity()
+	if err := arena.allocator.UnmarshalBinary(data[len(data)-reader.Len():]); err != nil {
+		return fmt.Errorf("persistent arena '%s': %w", persistent.Path, err)
+	}
+	if arena.allocator.Capacity() < size {
+		if err := arena.allocator.Grow(size); err != nil {
+			return err
+		}
+	}
+	if used := r.arenaBytes(); r.maxAlloc > 0 && used > r.maxAlloc {
+		return fmt.Errorf("persistent arena '%s' of %d bytes exceeds the limit of %d bytes (%d in use by enclosing blocks)",
+			persistent.Path, arena.allocator.Capacity(), r.maxAlloc, used-arena.allocator.Capacity())
+	}
+
+	for len(r.slots) < persistent.Base {
+		r.slots = append(r.slots, SlotEntry{})
+	}
+	for _, s := range saved {
+		if int(s.Offset+s.Size) > arena.allocator.Capacity() {
+			return fmt.Errorf("persistent arena '%s' has slot %d outside its buffer", persistent.Path, s.ID)
+		}
+		id := persistent.Base + int(s.ID)
+		for len(r.slots) <= id {
+			r.slots = append(r.slots, SlotEntry{})
+		}
+		r.slots[id] = SlotEntry{
+			Offset:   int(s.Offset),
+			Size:     int(s.Size),
+			Tag:      s.Tag,
+			Mask:     s.Mask,
+			Alive:    true,
+			Stencil:  s.Stencil,
+			Length:   int(s.Length),
+			Arena:    index,
+			Restored: true,
+		}
+	}
+	r.allocator = arena.allocator
+	r.reshadow(index)
+	return nil
+}
+
+// claim reports whether slot id was restored from the file of a persistent
+// arena and not claimed yet. Its allocating instruction then keeps the
+// restored region and value instead of reserving a new one.
+func (r *Runtime) claim(id, line, site int) bool {
+	if id >= len(r.slots) || !r.slots[id].Restored {
+		return false
+	}
+	r.slots[id].Restored = false
+	r.slots[id].Line, r.slots[id].Site = line, site
+	return true
+}
+
+// zero gives slot id, a declared variable of a single type in a persistent
+// arena that has nothing to restore, the zero value of that type. A counter
+// then starts at 0 on the first run and continues from the saved value on
+// the next ones, and a string starts empty, with a length prefix of 0.
+func (r *Runtime) zero(id int) error {
+	slot := &r.slots[id]
+	if r.arenas[slot.Arena].persistent == nil {
+		return nil
+	}
+	if slot.Tag == value.TagString {
+		return r.storeString(id, value.NewString(""))
+	}
+	if bits.OnesCount8(slot.Mask) != 1 {
+		return nil
+	}
+	clear(r.memory(*slot).Slice(slot.Offset, slot.Size))
+	slot.Tag = value.TypeTag(bits.TrailingZeros8(slot.Mask) + 1)
+	return nil
+}
+
+// save writes the arena at index to the file of its persistent block. The
+// file is written under a temporary name and renamed over the old one, so
+// an error leaves the state of the previous run in place.
+func (r *Runtime) save(index int) error {
+	arena := r.arenas[index]
+	persistent := arena.persistent
+
+	var saved []arenaSlot
+	for id := persistent.Base; id < len(r.slots); id++ {
+		slot := r.slots[id]
+		if !slot.Alive || slot.Alias || slot.Arena != index {
+			continue
+		}
+		saved = append(saved, arenaSlot{
+			ID:      uint32(id - persistent.Base),
+			Offset:  uint32(slot.Offset),
+			Size:    uint32(slot.Size),
+			Length:  uint32(slot.Length),
+			Tag:     slot.Tag,
+			Mask:    slot.Mask,
+			Stencil: slot.Stencil,
+		})
+	}
+	state, err := arena.allocator.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("persistent arena '%s': %w", persistent.Path, err)
+	}
+
+	var data bytes.Buffer
+	binary.Write(&data, binary.LittleEndian, arenaHeader{
+		Magic:       arenaMagic,
+		Version:     arenaVersion,
+		Fingerprint: persistent.Fingerprint,
+		Slots:       uint32(len(saved)),
+	})
+	binary.Write(&data, binary.LittleEndian, saved)
+	data.Write(state)
+
+	fs := r.native.FS
+	if dir := path.Dir(persistent.Path); dir != "/" && dir != "." {
+		if exists, err := fs.LookupMetadata(r.ctx, dir); err == nil && !exists {
+			if err := fs.CreateDirectory(r.ctx, dir); err != nil {
+				return fmt.Errorf("persistent arena '%s': %w", persistent.Path, err)
+			}
+		}
+	}
+	temp := persistent.Path + ".tmp"
+	if exists, err := fs.LookupMetadata(r.ctx, temp); err == nil && exists {
+		if err := fs.UnlinkFile(r.ctx, temp); err != nil {
+			return fmt.Errorf("persistent arena '%s': %w", persistent.Path, err)
+		}
+	}
+	if _, err := fs.WriteFile(r.ctx, temp, 0, data.Bytes()); err != nil {
+		return fmt.Errorf("persistent arena '%s': %w", persistent.Path, err)
+	}
+	if err := fs.Rename(r.ctx, temp, persistent.Path); err != nil {
+		return fmt.Errorf("persistent arena '%s': %w", persistent.Path, err)
+	}
+	return nil
+}
@@ -1,8 +1,13 @@
 package vm
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/mwantia/vega/pkg/alloc"
 	"github.com/mwantia/vega/pkg/compiler"
@@ -17,6 +22,27 @@ type SlotEntry struct {
 	Alive   bool
 	Alias   bool // true = manually positioned pointer, not allocator-owned
 	Stencil bool // true = stencil-based allocation (struct/tuple)
+	Length  int  // element count for arrays (Tag is the element tag), 0 otherwise
+	Arena   int  // index of the arena whose allocator owns the region
+	Line    int  // source line of the allocation
+	Site    int  // address of the allocating instruction, the key of its debug symbol
+
+	// Restored is true for a slot loaded from the file of a persistent
+	// arena until its allocating instruction claims it
+	Restored bool
+}
+
+// Arena is the allocator of one alloc block. Nested blocks push an arena on
+// entry and pop it on exit; slots keep addressing the arena they were
+// allocated in, so inner blocks can use the variables of outer ones.
+type Arena struct {
+	allocator alloc.Allocator
+	base      int     // length of the slot table when the block was entered
+	ceiling   int     // capacity the allocator may grow to, 0 for a fixed arena
+	growths   int     // number of times the allocator has grown
+	shadow    []int32 // owner of every byte in sanitize mode, see own
+
+	persistent *compiler.PersistentArena // file the arena is loaded from and saved to, nil for most
 }
 
 type Runtime struct {
@@ -24,18 +50,27 @@ type Runtime struct {
 	Index  int
 
 	exprStack *ExprStack
-	allocator *alloc.Allocator
+	arenas    []Arena         // enclosing alloc blocks, innermost last
+	allocator alloc.Allocator // allocator of the innermost arena
 	slots     []SlotEntry
 	native    *Native
+	maxAlloc  int // combined capacity limit of all live arenas, 0 for none
+	onGrowth  func(ArenaGrowth)
+	sanitize  bool       // track byte ownership and check alias accesses
+	leakCheck bool       // report live slots when an alloc block exits
+	snapshots []Snapshot // open atomic blocks, innermost last
+	line      int        // source line of the executing instruction
+	ctx       context.Context
 }
 
 type CallFrame struct {
 	ByteCode           *compiler.ByteCode
 	InstructionPointer int
-	BasePointer        int
+	BasePointer        int // index of the frame's slot 0 in the slot table
 }
 
 func (r *Runtime) ExecuteFrames(ctx context.Context) error {
+	r.ctx = ctx
 	for {
 		select {
 		// Check for context cancellation
@@ -52,7 +87,9 @@ func (r *Runtime) ExecuteFrames(ctx context.Context) error {
 				return nil
 			}
 			// Return from function without explicit return
-			r.Index--
+			if err := r.returnFromFrame(0); err != nil {
+				return err
+			}
 			continue
 		}
 
@@ -60,19 +97,59 @@ func (r *Runtime) ExecuteFrames(ctx context.Context) error {
 		frame.InstructionPointer++
 
 		if err := r.ExecuteInstruction(instr, frame); err != nil {
-			return fmt.Errorf("line %d: %w", instr.SourceLine, err)
+			err = fmt.Errorf("line %d: %w", instr.SourceLine, err)
+			if !r.rollback(err) {
+				return err
+			}
 		}
 	}
 }
 
 func (r *Runtime) ExecuteInstruction(instr compiler.Instruction, frame *CallFrame) error {
+	r.line = instr.SourceLine
 	switch instr.Operation {
 	case compiler.OpStackALLOC:
-		if err := r.allocStack(instr.Argument); err != nil {
+		if r.exprStack == nil {
+			r.exprStack = &ExprStack{}
+		}
+		// A growable block pushes its ceiling after the capacity
+		ceiling := 0
+		if instr.Argument == 1 {
+			n, err := r.popSize()
+			if err != nil {
+				return fmt.Errorf("instr 'OpStackALLOC': %w", err)
+			}
+			ceiling = n
+		}
+		size, err := r.popSize()
+		if err != nil {
 			return fmt.Errorf("instr 'OpStackALLOC': %w", err)
 		}
+		if err := r.allocStack(size, ceiling, alloc.Strategy(instr.Extra), instr.Offset); err != nil {
+			return fmt.Errorf("instr 'OpStackALLOC': %w", err)
+		}
+		if instr.Persistent != nil {
+			if err := r.load(len(r.arenas)-1, instr.Persistent); err != nil {
+				return fmt.Errorf("instr 'OpStackALLOC': %w", err)
+			}
+		}
 
 	case compiler.OpStackFREE:
+		// The live slots of a persistent arena are its saved state
+		persistent := len(r.arenas) > 0 && r.arenas[len(r.arenas)-1].persistent != nil
+		if r.leakCheck && !persistent {
+			if report := r.leaks(frame.ByteCode); report != "" {
+				if instr.Argument == 1 {
+					return fmt.Errorf("instr 'OpStackFREE': %s", report)
+				}
+				fmt.Fprintf(r.native.Stderr, "warning: line %d: %s\n", instr.SourceLine, report)
+			}
+		}
+		if persistent {
+			if err := r.save(len(r.arenas) - 1); err != nil {
+				return fmt.Errorf("instr 'OpStackFREE': %w", err)
+			}
+		}
 		r.freeStack()
 
 	case compiler.OpLoadCONST:
@@ -97,15 +174,18 @@ func (r *Runtime) ExecuteInstruction(instr compiler.Instruction, frame *CallFram
 		}
 
 	case compiler.OpVarALLOC:
-		slotID := instr.Argument
+		slotID := frame.BasePointer + instr.Argument
 		mask := instr.Extra
 		size := value.MaxSizeForMask(mask)
 
 		if r.allocator == nil {
 			return fmt.Errorf("instr 'OpVarALLOC': no allocator active")
 		}
+		if r.claim(slotID, instr.SourceLine, frame.InstructionPointer-1) {
+			break
+		}
 
-		offset, err := r.allocator.Alloc(size)
+		offset, err := r.allocate(len(r.arenas)-1, size)
 		if err != nil {
 			return fmt.Errorf("instr 'OpVarALLOC': %w", err)
 		}
@@ -120,10 +200,17 @@ func (r *Runtime) ExecuteInstruction(instr compiler.Instruction, frame *CallFram
 			Tag:    0, // uninitialized until first store
 			Mask:   mask,
 			Alive:  true,
+			Arena:  len(r.arenas) - 1,
+			Line:   instr.SourceLine,
+			Site:   frame.InstructionPointer - 1,
+		}
+		r.own(slotID)
+		if err := r.zero(slotID); err != nil {
+			return fmt.Errorf("instr 'OpVarALLOC': %w", err)
 		}
 
 	case compiler.OpVarSTORE:
-		slotID := instr.Argument
+		slotID := frame.BasePointer + instr.Argument
 		if slotID >= len(r.slots) || !r.slots[slotID].Alive {
 			return fmt.Errorf("instr 'OpVarSTORE': slot %d is not alive", slotID)
 		}
@@ -148,10 +235,15 @@ func (r *Runtime) ExecuteInstruction(instr compiler.Instruction, frame *CallFram
 			return fmt.Errorf("instr 'OpVarSTORE': type mismatch: slot mask %08b does not allow tag %d", slot.Mask, tag)
 		}
 		slot.Tag = tag
+		if slot.Alias {
+			if err := r.checkAlias(slotID, slot.Size, true); err != nil {
+				return fmt.Errorf("instr 'OpVarSTORE': %w", err)
+			}
+		}
 
 		// Copy the value's backing bytes into the alloc buffer.
 		// This is the one copy point: from constant/temporary → alloc buffer.
-		dest := r.allocator.Slice(slot.Offset, slot.Size)
+		dest := r.memory(*slot).Slice(slot.Offset, slot.Size)
 		src := alloc.View()
 		n := copy(dest, src)
 		for i := n; i < len(dest); i++ {
@@ -159,7 +251,7 @@ func (r *Runtime) ExecuteInstruction(instr compiler.Instruction, frame *CallFram
 		}
 
 	case compiler.OpVarLOAD:
-		slotID := instr.Argument
+		slotID := frame.BasePointer + instr.Argument
 		if slotID >= len(r.slots) || !r.slots[slotID].Alive {
 			return fmt.Errorf("instr 'OpVarLOAD': use after free on slot %d", slotID)
 		}
@@ -176,7 +268,12 @@ func (r *Runtime) ExecuteInstruction(instr compiler.Instruction, frame *CallFram
 		// Create a view-based value that points directly into the alloc buffer.
 		// No copy — the value reads from the allocator's memory.
 		typeSize := value.SizeForTag(slot.Tag)
-		view := r.allocator.Slice(slot.Offset, typeSize)
+		if slot.Alias {
+			if err := r.checkAlias(slotID, typeSize, false); err != nil {
+				return fmt.Errorf("instr 'OpVarLOAD': %w", err)
+			}
+		}
+		view := r.memory(slot).Slice(slot.Offset, typeSize)
 		val, err := value.Wrap(slot.Tag, view)
 		if err != nil {
 			return fmt.Errorf("instr 'OpVarLOAD': %w", err)
@@ -184,8 +281,11 @@ func (r *Runtime) ExecuteInstruction(instr compiler.Instruction, frame *CallFram
 		r.exprStack.Push(val)
 
 	case compiler.OpVarFREE:
-		slotID := instr.Argument
+		slotID := frame.BasePointer + instr.Argument
 		if slotID >= len(r.slots) || !r.slots[slotID].Alive {
+			if instr.Extra&compiler.FreeScoped != 0 {
+				break // a local freed in a branch of its block
+			}
 			return fmt.Errorf("instr 'OpVarFREE': double free on slot %d", slotID)
 		}
 
@@ -194,11 +294,21 @@ func (r *Runtime) ExecuteInstruction(instr compiler.Instruction, frame *CallFram
 		}
 
 		slot := r.slots[slotID]
-		r.allocator.Free(slot.Offset, slot.Size)
+		// String slots own no memory until their first store. A bump arena
+		// cannot free a local that was not allocated last, such as a string
+		// that outgrew its region; like release, it keeps the bytes until
+		// the block exits. Only free(x) reports that.
+		if slot.Size > 0 {
+			err := r.memory(slot).Free(slot.Offset, slot.Size)
+			if err != nil && (instr.Extra&compiler.FreeScoped == 0 || !errors.Is(err, alloc.ErrFreeUnsupported)) {
+				return fmt.Errorf("instr 'OpVarFREE': slot %d: %w", slotID, err)
+			}
+		}
+		r.disown(slot)
 		r.slots[slotID].Alive = false
 
 	case compiler.OpVarPTR:
-		slotID := instr.Argument
+		slotID := frame.BasePointer + instr.Argument
 		tag := value.TypeTag(instr.Extra)
 		size := value.SizeForTag(tag)
 
@@ -240,17 +350,21 @@ func (r *Runtime) ExecuteInstruction(instr compiler.Instruction, frame *CallFram
 			Mask:   value.MaskForTag(tag),
 			Alive:  true,
 			Alias:  true,
+			Arena:  len(r.arenas) - 1,
 		}
 
 	case compiler.OpStencilALLOC:
-		slotID := instr.Argument
+		slotID := frame.BasePointer + instr.Argument
 		totalSize := instr.Offset
 
 		if r.allocator == nil {
 			return fmt.Errorf("instr 'OpStencilALLOC': no allocator active")
 		}
+		if r.claim(slotID, instr.SourceLine, frame.InstructionPointer-1) {
+			break
+		}
 
-		offset, err := r.allocator.Alloc(totalSize)
+		offset, err := r.allocate(len(r.arenas)-1, totalSize)
 		if err != nil {
 			return fmt.Errorf("instr 'OpStencilALLOC': %w", err)
 		}
@@ -265,10 +379,14 @@ func (r *Runtime) ExecuteInstruction(instr compiler.Instruction, frame *CallFram
 			Mask:    0,
 			Alive:   true,
 			Stencil: true,
+			Arena:   len(r.arenas) - 1,
+			Line:    instr.SourceLine,
+			Site:    frame.InstructionPointer - 1,
 		}
+		r.own(slotID)
 
 	case compiler.OpFieldSTORE:
-		slotID := instr.Argument
+		slotID := frame.BasePointer + instr.Argument
 		fieldOffset := instr.Offset
 		tag := value.TypeTag(instr.Extra)
 
@@ -296,12 +414,12 @@ func (r *Runtime) ExecuteInstruction(instr compiler.Instruction, frame *CallFram
 
 		slot := r.slots[slotID]
 		fieldSize := value.SizeForTag(tag)
-		dest := r.allocator.Slice(slot.Offset+fieldOffset, fieldSize)
+		dest := r.memory(slot).Slice(slot.Offset+fieldOffset, fieldSize)
 		src := alloc.View()
 		copy(dest, src)
 
 	case compiler.OpFieldLOAD:
-		slotID := instr.Argument
+		slotID := frame.BasePointer + instr.Argument
 		fieldOffset := instr.Offset
 		tag := value.TypeTag(instr.Extra)
 
@@ -314,13 +432,302 @@ func (r *Runtime) ExecuteInstruction(instr compiler.Instruction, frame *CallFram
 
 		slot := r.slots[slotID]
 		fieldSize := value.SizeForTag(tag)
-		view := r.allocator.Slice(slot.Offset+fieldOffset, fieldSize)
+		view := r.memory(slot).Slice(slot.Offset+fieldOffset, fieldSize)
 		val, err := value.Wrap(tag, view)
 		if err != nil {
 			return fmt.Errorf("instr 'OpFieldLOAD': %w", err)
 		}
 		r.exprStack.Push(val)
 
+	case compiler.OpStencilCOPY:
+		dst, src, err := r.stencilPair(frame, instr)
+		if err != nil {
+			return fmt.Errorf("instr 'OpStencilCOPY': %w", err)
+		}
+		// copy handles overlapping regions, so 'p = p' is harmless
+		copy(r.memory(dst).Slice(dst.Offset, dst.Size), r.memory(src).Slice(src.Offset, src.Size))
+
+	case compiler.OpStencilEQ:
+		left, right, err := r.stencilPair(frame, instr)
+		if err != nil {
+			return fmt.Errorf("instr 'OpStencilEQ': %w", err)
+		}
+		if r.exprStack == nil {
+			return fmt.Errorf("instr 'OpStencilEQ': undefined stack")
+		}
+		equal := bytes.Equal(r.memory(left).Slice(left.Offset, left.Size), r.memory(right).Slice(right.Offset, right.Size))
+		r.exprStack.Push(value.FromBool(equal))
+
+	case compiler.OpAtomicBEGIN:
+		if err := r.snapshot(instr.Argument, instr.SourceLine, instr.Extra == 1); err != nil {
+			return fmt.Errorf("instr 'OpAtomicBEGIN': %w", err)
+		}
+
+	case compiler.OpAtomicEND:
+		if err := r.commit(); err != nil {
+			return fmt.Errorf("instr 'OpAtomicEND': %w", err)
+		}
+
+	case compiler.OpArenaCOMPACT:
+		if r.allocator == nil {
+			return fmt.Errorf("instr 'OpArenaCOMPACT': no allocator active")
+		}
+		moved, err := r.compact(len(r.arenas) - 1)
+		if err != nil {
+			return fmt.Errorf("instr 'OpArenaCOMPACT': %w", err)
+		}
+		result, err := value.FromInt64(value.TagInteger, int64(moved))
+		if err != nil {
+			return fmt.Errorf("instr 'OpArenaCOMPACT': %w", err)
+		}
+		r.exprStack.Push(result)
+
+	case compiler.OpTagCONVERT:
+		if r.exprStack == nil {
+			return fmt.Errorf("instr 'OpTagCONVERT': undefined stack")
+		}
+		val, err := r.exprStack.Pop()
+		if err != nil {
+			return fmt.Errorf("instr 'OpTagCONVERT': %w", err)
+		}
+		alloc, ok := val.(value.Allocable)
+		if !ok {
+			return fmt.Errorf("instr 'OpTagCONVERT': value is not allocable")
+		}
+		result, err := value.Convert(alloc, value.TypeTag(instr.Extra), instr.Argument == 1)
+		if err != nil {
+			return fmt.Errorf("instr 'OpTagCONVERT': %w", err)
+		}
+		r.exprStack.Push(result)
+
+	case compiler.OpArrayALLOC:
+		slotID := frame.BasePointer + instr.Argument
+		tag := value.TypeTag(instr.Extra)
+		length := instr.Offset
+		size := length * value.SizeForTag(tag)
+
+		if r.allocator == nil {
+			return fmt.Errorf("instr 'OpArrayALLOC': no allocator active")
+		}
+		if r.claim(slotID, instr.SourceLine, frame.InstructionPointer-1) {
+			break
+		}
+
+		offset, err := r.allocate(len(r.arenas)-1, size)
+		if err != nil {
+			return fmt.Errorf("instr 'OpArrayALLOC': %w", err)
+		}
+		// Arrays start zeroed; reused free-list memory may hold old bytes
+		clear(r.allocator.Slice(offset, size))
+
+		for len(r.slots) <= slotID {
+			r.slots = append(r.slots, SlotEntry{})
+		}
+		r.slots[slotID] = SlotEntry{
+			Offset: offset,
+			Size:   size,
+			Tag:    tag,
+			Mask:   value.MaskForTag(tag),
+			Alive:  true,
+			Length: length,
+			Arena:  len(r.arenas) - 1,
+			Line:   instr.SourceLine,
+			Site:   frame.InstructionPointer - 1,
+		}
+		r.own(slotID)
+
+	case compiler.OpArrayLOAD:
+		slotID := frame.BasePointer + instr.Argument
+		tag := value.TypeTag(instr.Extra)
+
+		offset, err := r.popElementOffset(slotID, tag)
+		if err != nil {
+			return fmt.Errorf("instr 'OpArrayLOAD': %w", err)
+		}
+
+		view := r.memory(r.slots[slotID]).Slice(offset, value.SizeForTag(tag))
+		val, err := value.Wrap(tag, view)
+		if err != nil {
+			return fmt.Errorf("instr 'OpArrayLOAD': %w", err)
+		}
+		r.exprStack.Push(val)
+
+	case compiler.OpArraySTORE:
+		slotID := frame.BasePointer + instr.Argument
+		tag := value.TypeTag(instr.Extra)
+
+		if r.exprStack == nil {
+			return fmt.Errorf("instr 'OpArraySTORE': undefined stack")
+		}
+
+		val, err := r.exprStack.Pop()
+		if err != nil {
+			return fmt.Errorf("instr 'OpArraySTORE': %w", err)
+		}
+
+		alloc, ok := val.(value.Allocable)
+		if !ok {
+			return fmt.Errorf("instr 'OpArraySTORE': value is not allocable")
+		}
+
+		actualTag := value.TagFor(alloc)
+		if actualTag != tag {
+			return fmt.Errorf("instr 'OpArraySTORE': type mismatch: expected tag %d, got %d", tag, actualTag)
+		}
+
+		offset, err := r.popElementOffset(slotID, tag)
+		if err != nil {
+			return fmt.Errorf("instr 'OpArraySTORE': %w", err)
+		}
+
+		dest := r.memory(r.slots[slotID]).Slice(offset, value.SizeForTag(tag))
+		copy(dest, alloc.View())
+
+	case compiler.OpArrayLEN:
+		slotID := frame.BasePointer + instr.Argument
+
+		if slotID >= len(r.slots) || !r.slots[slotID].Alive {
+			return fmt.Errorf("instr 'OpArrayLEN': slot %d is not alive", slotID)
+		}
+		if r.exprStack == nil {
+			return fmt.Errorf("instr 'OpArrayLEN': undefined stack")
+		}
+
+		length, err := value.FromInt64(value.TagInteger, int64(r.slots[slotID].Length))
+		if err != nil {
+			return fmt.Errorf("instr 'OpArrayLEN': %w", err)
+		}
+		r.exprStack.Push(length)
+
+	case compiler.OpStrALLOC:
+		slotID := frame.BasePointer + instr.Argument
+		if r.claim(slotID, instr.SourceLine, frame.InstructionPointer-1) {
+			break
+		}
+
+		for len(r.slots) <= slotID {
+			r.slots = append(r.slots, SlotEntry{})
+		}
+		// The region is reserved by the first OpStrSTORE, once the length is known
+		r.slots[slotID] = SlotEntry{
+			Tag:   value.TagString,
+			Alive: true,
+			Arena: len(r.arenas) - 1,
+			Line:  instr.SourceLine,
+			Site:  frame.InstructionPointer - 1,
+		}
+		// A declared string has no value to store
+		if instr.Extra == 1 {
+			if err := r.zero(slotID); err != nil {
+				return fmt.Errorf("instr 'OpStrALLOC': %w", err)
+			}
+		}
+
+	case compiler.OpStrSTORE:
+		slotID := frame.BasePointer + instr.Argument
+		if slotID >= len(r.slots) || !r.slots[slotID].Alive {
+			return fmt.Errorf("instr 'OpStrSTORE': slot %d is not alive", slotID)
+		}
+		if r.exprStack == nil {
+			return fmt.Errorf("instr 'OpStrSTORE': undefined stack")
+		}
+
+		val, err := r.exprStack.Pop()
+		if err != nil {
+			return fmt.Errorf("instr 'OpStrSTORE': %w", err)
+		}
+		str, ok := val.(*value.StringSlice)
+		if !ok {
+			return fmt.Errorf("instr 'OpStrSTORE': type mismatch: expected string, got %s", val.Type())
+		}
+
+		if err := r.storeString(slotID, str); err != nil {
+			return fmt.Errorf("instr 'OpStrSTORE': %w", err)
+		}
+
+	case compiler.OpStrLOAD:
+		slotID := frame.BasePointer + instr.Argument
+		if slotID >= len(r.slots) || !r.slots[slotID].Alive {
+			return fmt.Errorf("instr 'OpStrLOAD': use after free on slot %d", slotID)
+		}
+
+		slot := r.slots[slotID]
+		if slot.Size == 0 {
+			return fmt.Errorf("instr 'OpStrLOAD': slot %d is uninitialized", slotID)
+		}
+		if r.exprStack == nil {
+			return fmt.Errorf("instr 'OpStrLOAD': undefined stack")
+		}
+
+		// View the bytes behind the length prefix; no copy
+		memory := r.memory(slot)
+		prefix := memory.Slice(slot.Offset, value.StringPrefixSize)
+		length := int(binary.LittleEndian.Uint32(prefix))
+		view := memory.Slice(slot.Offset+value.StringPrefixSize, length)
+		r.exprStack.Push(value.NewStringView(view))
+
+	case compiler.OpStrCONCAT:
+		if r.exprStack == nil {
+			return fmt.Errorf("instr 'OpStrCONCAT': undefined stack")
+		}
+		right, err := r.popString()
+		if err != nil {
+			return fmt.Errorf("instr 'OpStrCONCAT': %w", err)
+		}
+		left, err := r.popString()
+		if err != nil {
+			return fmt.Errorf("instr 'OpStrCONCAT': %w", err)
+		}
+		r.exprStack.Push(left.Concat(right))
+
+	case compiler.OpStrLEN:
+		if r.exprStack == nil {
+			return fmt.Errorf("instr 'OpStrLEN': undefined stack")
+		}
+		str, err := r.popString()
+		if err != nil {
+			return fmt.Errorf("instr 'OpStrLEN': %w", err)
+		}
+		length, err := value.FromInt64(value.TagInteger, int64(str.Length()))
+		if err != nil {
+			return fmt.Errorf("instr 'OpStrLEN': %w", err)
+		}
+		r.exprStack.Push(length)
+
+	case compiler.OpStrINDEX:
+		if r.exprStack == nil {
+			return fmt.Errorf("instr 'OpStrINDEX': undefined stack")
+		}
+		index, err := r.exprStack.Pop()
+		if err != nil {
+			return fmt.Errorf("instr 'OpStrINDEX': %w", err)
+		}
+		str, err := r.popString()
+		if err != nil {
+			return fmt.Errorf("instr 'OpStrINDEX': %w", err)
+		}
+		element, err := str.Index(index)
+		if err != nil {
+			return fmt.Errorf("instr 'OpStrINDEX': %w", err)
+		}
+		r.exprStack.Push(element)
+
+	case compiler.OpStrFORMAT:
+		if r.exprStack == nil {
+			return fmt.Errorf("instr 'OpStrFORMAT': undefined stack")
+		}
+		// Parts are popped in reverse; each value is formatted by its own
+		// tag, so union-typed slots print what they currently hold.
+		parts := make([]string, instr.Argument)
+		for i := instr.Argument - 1; i >= 0; i-- {
+			val, err := r.exprStack.Pop()
+			if err != nil {
+				return fmt.Errorf("instr 'OpStrFORMAT': %w", err)
+			}
+			parts[i] = val.String()
+		}
+		r.exprStack.Push(value.NewString(strings.Join(parts, "")))
+
 	case compiler.OpCallNAT:
 		name := instr.Name
 		argc := instr.Argument
@@ -339,9 +746,180 @@ func (r *Runtime) ExecuteInstruction(instr compiler.Instruction, frame *CallFram
 			args[i] = val
 		}
 
-		if err := fn(r.native, args); err != nil {
+		results, err := fn(r.native, args)
+		if err != nil {
 			return fmt.Errorf("instr 'OpCallNAT' ('%s'): %w", name, err)
 		}
+		if len(results) != int(instr.Extra) {
+			return fmt.Errorf("instr 'OpCallNAT' ('%s'): returned %d values, expected %d", name, len(results), instr.Extra)
+		}
+		for _, result := range results {
+			r.exprStack.Push(result)
+		}
+
+	case compiler.OpArithADD:
+		left, right, err := r.popNumericOperands()
+		if err != nil {
+			return fmt.Errorf("instr 'OpArithADD': %w", err)
+		}
+		result, err := left.Add(right)
+		if err != nil {
+			return fmt.Errorf("instr 'OpArithADD': %w", err)
+		}
+		r.exprStack.Push(result)
+
+	case compiler.OpArithSUB:
+		left, right, err := r.popNumericOperands()
+		if err != nil {
+			return fmt.Errorf("instr 'OpArithSUB': %w", err)
+		}
+		result, err := left.Sub(right)
+		if err != nil {
+			return fmt.Errorf("instr 'OpArithSUB': %w", err)
+		}
+		r.exprStack.Push(result)
+
+	case compiler.OpArithMUL:
+		left, right, err := r.popNumericOperands()
+		if err != nil {
+			return fmt.Errorf("instr 'OpArithMUL': %w", err)
+		}
+		result, err := left.Mul(right)
+		if err != nil {
+			return fmt.Errorf("instr 'OpArithMUL': %w", err)
+		}
+		r.exprStack.Push(result)
+
+	case compiler.OpArithDIV:
+		left, right, err := r.popNumericOperands()
+		if err != nil {
+			return fmt.Errorf("instr 'OpArithDIV': %w", err)
+		}
+		result, err := left.Div(right)
+		if err != nil {
+			return fmt.Errorf("instr 'OpArithDIV': %w", err)
+		}
+		r.exprStack.Push(result)
+
+	case compiler.OpArithMOD:
+		left, right, err := r.popNumericOperands()
+		if err != nil {
+			return fmt.Errorf("instr 'OpArithMOD': %w", err)
+		}
+		result, err := left.Mod(right)
+		if err != nil {
+			return fmt.Errorf("instr 'OpArithMOD': %w", err)
+		}
+		r.exprStack.Push(result)
+
+	case compiler.OpArithNEG:
+		if r.exprStack == nil {
+			return fmt.Errorf("instr 'OpArithNEG': undefined stack")
+		}
+		val, err := r.exprStack.Pop()
+		if err != nil {
+			return fmt.Errorf("instr 'OpArithNEG': %w", err)
+		}
+		operand, ok := val.(value.Numeric)
+		if !ok {
+			return fmt.Errorf("instr 'OpArithNEG': operator not defined for %s", val.Type())
+		}
+		result, err := operand.Neg()
+		if err != nil {
+			return fmt.Errorf("instr 'OpArithNEG': %w", err)
+		}
+		r.exprStack.Push(result)
+
+	case compiler.OpCmpEQ:
+		if err := r.compare(func(c int) bool { return c == 0 }, false); err != nil {
+			return fmt.Errorf("instr 'OpCmpEQ': %w", err)
+		}
+
+	case compiler.OpCmpNE:
+		if err := r.compare(func(c int) bool { return c != 0 }, true); err != nil {
+			return fmt.Errorf("instr 'OpCmpNE': %w", err)
+		}
+
+	case compiler.OpCmpLT:
+		if err := r.compare(func(c int) bool { return c < 0 }, false); err != nil {
+			return fmt.Errorf("instr 'OpCmpLT': %w", err)
+		}
+
+	case compiler.OpCmpLE:
+		if err := r.compare(func(c int) bool { return c <= 0 }, false); err != nil {
+			return fmt.Errorf("instr 'OpCmpLE': %w", err)
+		}
+
+	case compiler.OpCmpGT:
+		if err := r.compare(func(c int) bool { return c > 0 }, false); err != nil {
+			return fmt.Errorf("instr 'OpCmpGT': %w", err)
+		}
+
+	case compiler.OpCmpGE:
+		if err := r.compare(func(c int) bool { return c >= 0 }, false); err != nil {
+			return fmt.Errorf("instr 'OpCmpGE': %w", err)
+		}
+
+	case compiler.OpLogicNOT:
+		cond, err := r.popCondition()
+		if err != nil {
+			return fmt.Errorf("instr 'OpLogicNOT': %w", err)
+		}
+		r.exprStack.Push(value.FromBool(!cond))
+
+	case compiler.OpStackDUP:
+		if r.exprStack == nil {
+			return fmt.Errorf("instr 'OpStackDUP': undefined stack")
+		}
+		val, err := r.exprStack.Peek()
+		if err != nil {
+			return fmt.Errorf("instr 'OpStackDUP': %w", err)
+		}
+		r.exprStack.Push(val)
+
+	case compiler.OpCallFN:
+		functions := r.Frames[0].ByteCode.Functions
+		if instr.Argument < 0 || instr.Argument >= len(functions) {
+			return fmt.Errorf("instr 'OpCallFN': unknown function '%s'", instr.Name)
+		}
+		if r.Index+1 >= MaxFrames {
+			return fmt.Errorf("instr 'OpCallFN': stack overflow: calling '%s' exceeds %d frames", instr.Name, MaxFrames)
+		}
+		if r.exprStack == nil {
+			return fmt.Errorf("instr 'OpCallFN': undefined stack")
+		}
+		// The callee's slots start after every slot of the caller
+		r.Index++
+		r.Frames[r.Index] = &CallFrame{
+			ByteCode:    functions[instr.Argument].ByteCode,
+			BasePointer: len(r.slots),
+		}
+
+	case compiler.OpFnRETURN:
+		if err := r.returnFromFrame(instr.Argument); err != nil {
+			return fmt.Errorf("instr 'OpFnRETURN': %w", err)
+		}
+
+	case compiler.OpJMP:
+		frame.InstructionPointer = instr.Argument
+
+	case compiler.OpJMP_IF_FALSE:
+		cond, err := r.popCondition()
+		if err != nil {
+			return fmt.Errorf("instr 'OpJMP_IF_FALSE': %w", err)
+		}
+		if !cond {
+			frame.InstructionPointer = instr.Argument
+		}
+
+	case compiler.OpJMP_IF_TRUE:
+		cond, err := r.popCondition()
+		if err != nil {
+			return fmt.Errorf("instr 'OpJMP_IF_TRUE': %w", err)
+		}
+		if cond {
+			frame.InstructionPointer = instr.Argument
+		}
 	}
 
 	return nil
@@ -351,18 +929,489 @@ func (r *Runtime) IndexedFrame() *CallFrame {
 	return r.Frames[r.Index]
 }
 
-func (r *Runtime) allocStack(size int) error {
-	if r.exprStack != nil {
-		return fmt.Errorf("stack already allocated")
+// popNumericOperands pops the right and then the left operand of a binary
+// arithmetic operation. Both must implement value.Numeric.
+func (r *Runtime) popNumericOperands() (value.Numeric, value.Numeric, error) {
+	if r.exprStack == nil {
+		return nil, nil, fmt.Errorf("undefined stack")
+	}
+	rightVal, err := r.exprStack.Pop()
+	if err != nil {
+		return nil, nil, err
+	}
+	leftVal, err := r.exprStack.Pop()
+	if err != nil {
+		return nil, nil, err
+	}
+	left, ok := leftVal.(value.Numeric)
+	if !ok {
+		return nil, nil, fmt.Errorf("operator not defined for %s", leftVal.Type())
+	}
+	right, ok := rightVal.(value.Numeric)
+	if !ok {
+		return nil, nil, fmt.Errorf("operator not defined for %s", rightVal.Type())
+	}
+	return left, right, nil
+}
+
+// returnFromFrame leaves the current function frame. The top count values on
+// the expr stack are the return values; they are copied out of the arena
+// before the frame's slots are released, since they may view those slots.
+func (r *Runtime) returnFromFrame(count int) error {
+	if r.Index == 0 {
+		return fmt.Errorf("return outside function")
+	}
+	frame := r.IndexedFrame()
+
+	if count > 0 {
+		if r.exprStack == nil || r.exprStack.Len() < count {
+			return fmt.Errorf("stack underflow")
+		}
+		top := r.exprStack.data[r.exprStack.Len()-count:]
+		for i, val := range top {
+			if alloc, ok := val.(value.Allocable); ok {
+				top[i] = value.Clone(alloc)
+			}
+		}
+	}
+
+	// Release in reverse so a bump arena can rewind over the whole frame
+	for i := len(r.slots) - 1; i >= frame.BasePointer; i-- {
+		slot := r.slots[i]
+		if slot.Alive && !slot.Alias && slot.Size > 0 {
+			if err := r.release(slot); err != nil {
+				return err
+			}
+		}
+	}
+	if frame.BasePointer < len(r.slots) {
+		r.slots = r.slots[:frame.BasePointer]
+	}
+
+	r.Frames[r.Index] = nil
+	r.Index--
+	return nil
+}
+
+// compare pops the right and then the left operand, orders them via
+// value.Comparable and pushes the boolean result of pred. NaN operands are
+// unordered and push the given fallback instead.
+func (r *Runtime) compare(pred func(int) bool, unordered bool) error {
+	if r.exprStack == nil {
+		return fmt.Errorf("undefined stack")
+	}
+	rightVal, err := r.exprStack.Pop()
+	if err != nil {
+		return err
+	}
+	leftVal, err := r.exprStack.Pop()
+	if err != nil {
+		return err
+	}
+	left, ok := leftVal.(value.Comparable)
+	if !ok {
+		return fmt.Errorf("cannot compare %s", leftVal.Type())
+	}
+	right, ok := rightVal.(value.Comparable)
+	if !ok {
+		return fmt.Errorf("cannot compare %s", rightVal.Type())
+	}
+
+	c, err := left.Compare(right)
+	if errors.Is(err, value.ErrUnordered) {
+		r.exprStack.Push(value.FromBool(unordered))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r.exprStack.Push(value.FromBool(pred(c)))
+	return nil
+}
+
+// popCondition pops a boolean from the expr stack.
+func (r *Runtime) popCondition() (bool, error) {
+	if r.exprStack == nil {
+		return false, fmt.Errorf("undefined stack")
+	}
+	val, err := r.exprStack.Pop()
+	if err != nil {
+		return false, err
+	}
+	cond, ok := val.(*value.BooleanValue)
+	if !ok {
+		return false, fmt.Errorf("condition must be boolean, got %s", val.Type())
+	}
+	return cond.Data(), nil
+}
+
+// allocStack enters an alloc block of the given capacity. The outermost
+// block creates the slot table; nested blocks share it and only push an
+// arena of their own. A ceiling above zero makes the arena growable up to
+// that capacity. The combined capacity of all arenas is bounded by maxAlloc.
+func (r *Runtime) allocStack(size, ceiling int, strategy alloc.Strategy, slotSize int) error {
+	if size < 0 {
+		return fmt.Errorf("alloc size must not be negative, got %d", size)
+	}
+	if ceiling != 0 && ceiling < size {
+		return fmt.Errorf("grow ceiling %d is smaller than the alloc size %d", ceiling, size)
+	}
+	if used := r.arenaBytes(); r.maxAlloc > 0 && size > r.maxAlloc-used {
+		return fmt.Errorf("alloc size %d exceeds the limit of %d bytes (%d in use by enclosing blocks)", size, r.maxAlloc, used)
+	}
+	allocator, err := alloc.New(strategy, size, slotSize)
+	if err != nil {
+		return err
+	}
+	if len(r.arenas) == 0 {
+		r.slots = make([]SlotEntry, 0)
+	}
+	arena := Arena{
+		allocator: allocator,
+		base:      len(r.slots),
+		ceiling:   ceiling,
+	}
+	if r.sanitize {
+		arena.shadow = make([]int32, size)
+	}
+	r.arenas = append(r.arenas, arena)
+	r.allocator = allocator
+	return nil
+}
+
+// arenaBytes returns the combined capacity of all live arenas.
+func (r *Runtime) arenaBytes() int {
+	used := 0
+	for _, arena := range r.arenas {
+		used += arena.allocator.Capacity()
+	}
+	return used
+}
+
+// allocate reserves size bytes in the arena at index. When the free space
+// would fit the request but is fragmented, the arena is compacted first. A
+// growable arena that is still out of memory grows until the request fits or
+// its ceiling is reached.
+func (r *Runtime) allocate(index, size int) (int, error) {
+	arena := &r.arenas[index]
+	offset, err := arena.allocator.Alloc(size)
+	if err != nil && arena.allocator.FreeSpace() >= size {
+		if _, cerr := r.compact(index); cerr != nil {
+			err = fmt.Errorf("%w (not compacted: %v)", err, cerr)
+		} else {
+			offset, err = arena.allocator.Alloc(size)
+		}
+	}
+	if pool, ok := arena.allocator.(*alloc.Pool); ok && size > pool.SlotSize() {
+		return 0, err // growing adds slots, not larger ones
+	}
+	for err != nil && arena.ceiling > 0 {
+		if arena.allocator.Capacity() >= arena.ceiling {
+			return 0, fmt.Errorf("%w; the block is at its grow ceiling of %d bytes", err, arena.ceiling)
+		}
+		if err := r.grow(index, size); err != nil {
+			return 0, err
+		}
+		offset, err = arena.allocator.Alloc(size)
+	}
+	return offset, err
+}
+
+// grow at least doubles the capacity of the arena at index, by no less than
+// need bytes and up to its ceiling and the VM limit. The buffer moves, so
+// every value on the expression stack that views it is re-sliced.
+func (r *Runtime) grow(index, need int) error {
+	arena := &r.arenas[index]
+	from := arena.allocator.Capacity()
+	to := min(max(from*2, from+need), arena.ceiling)
+	if r.maxAlloc > 0 {
+		to = min(to, from+r.maxAlloc-r.arenaBytes())
+		if to <= from {
+			return fmt.Errorf("cannot grow alloc block beyond %d bytes: the limit of %d bytes is reached", from, r.maxAlloc)
+		}
+	}
+
+	old := arena.allocator.Slice(0, from)
+	if err := arena.allocator.Grow(to); err != nil {
+		return err
+	}
+	r.rebase(old, arena.allocator.Slice(0, to), func(offset int) int {
+		return offset
+	})
+	if r.sanitize {
+		arena.shadow = append(arena.shadow, make([]int32, to-from)...)
+	}
+	if index == len(r.arenas)-1 {
+		r.allocator = arena.allocator
+	}
+
+	arena.growths++
+	if r.onGrowth != nil {
+		r.onGrowth(ArenaGrowth{
+			Line:    r.line,
+			Depth:   index,
+			From:    from,
+			To:      to,
+			Ceiling: arena.ceiling,
+			Count:   arena.growths,
+		})
+	}
+	return nil
+}
+
+// compact slides the live regions of the arena at index together, so its
+// free space becomes a single block, and returns the number of bytes moved.
+// Slot offsets and the views on the expression stack follow their data. A
+// pointer alias is not moved, so compaction is refused when one of them
+// views bytes that would change.
+func (r *Runtime) compact(index int) (int, error) {
+	memory := r.arenas[index].allocator
+	compactor, ok := memory.(alloc.Compactor)
+	if !ok {
+		return 0, nil
+	}
+
+	var ids []int
+	for id, slot := range r.slots {
+		if slot.Arena == index && slot.Alive && !slot.Alias && slot.Size > 0 {
+			ids = append(ids, id)
+		}
+	}
+	slices.SortFunc(ids, func(a, b int) int {
+		return r.slots[a].Offset - r.slots[b].Offset
+	})
+	live := make([]alloc.Region, len(ids))
+	for i, id := range ids {
+		live[i] = alloc.Region{Offset: r.slots[id].Offset, Size: r.slots[id].Size}
+	}
+
+	packed := alloc.Pack(live)
+	first := -1
+	for i := range live {
+		if live[i] != packed[i] {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return 0, nil
+	}
+	// Every byte from the first moved region to the end of the last one may
+	// change
+	start, end := packed[first].Offset, live[len(live)-1].Offset+live[len(live)-1].Size
+	for _, slot := range r.slots {
+		if slot.Arena == index && slot.Alive && slot.Alias && slot.Offset < end && slot.Offset+slot.Size > start {
+			return 0, fmt.Errorf("pointer alias at offset %d views a region that would move", slot.Offset)
+		}
+	}
+
+	buffer := memory.Slice(0, memory.Capacity())
+	compactor.Compact(live)
+	moved := 0
+	for i, id := range ids[first:] {
+		r.slots[id].Offset = packed[first+i].Offset
+		moved += packed[first+i].Size
+	}
+	r.reshadow(index)
+	r.rebase(buffer, buffer, func(offset int) int {
+		// The first region ending at or after offset holds it, if any
+		i, _ := slices.BinarySearchFunc(live, offset, func(region alloc.Region, offset int) int {
+			return region.Offset + region.Size - 1 - offset
+		})
+		if i == len(live) || live[i].Offset > offset {
+			return offset
+		}
+		return offset - live[i].Offset + packed[i].Offset
+	})
+	return moved, nil
+}
+
+// rebase points every value on the expression stack that views old at the
+// bytes now holding its data in buf, at the offset returned by moved. A
+// view into the buffer always extends to its end, so its offset follows
+// from its capacity.
+func (r *Runtime) rebase(old, buf []byte, moved func(offset int) int) {
+	if r.exprStack == nil || len(old) == 0 {
+		return
+	}
+	for i, val := range r.exprStack.data {
+		a, ok := val.(value.Allocable)
+		if !ok {
+			continue
+		}
+		view := a.View()
+		c := cap(view)
+		if c == 0 || c > len(old) || &view[:c][c-1] != &old[len(old)-1] {
+			continue
+		}
+		offset := moved(len(old) - c)
+		view = buf[offset : offset+len(view)]
+		if _, ok := a.(*value.StringSlice); ok {
+			r.exprStack.data[i] = value.NewStringView(view)
+			continue
+		}
+		if wrapped, err := value.Wrap(value.TagFor(a), view); err == nil {
+			r.exprStack.data[i] = wrapped
+		}
+	}
+}
+
+// memory returns the allocator that owns the region of slot.
+func (r *Runtime) memory(slot SlotEntry) alloc.Allocator {
+	return r.arenas[slot.Arena].allocator
+}
+
+// release frees a region the runtime gives up on its own, such as a frame's
+// locals or a string's outgrown buffer. Strategies that cannot free it keep
+// the bytes until the arena is discarded.
+func (r *Runtime) release(slot SlotEntry) error {
+	r.disown(slot)
+	if err := r.memory(slot).Free(slot.Offset, slot.Size); err != nil && !errors.Is(err, alloc.ErrFreeUnsupported) {
+		return err
 	}
-	r.exprStack = &ExprStack{}
-	r.allocator = alloc.NewAllocator(size)
-	r.slots = make([]SlotEntry, 0)
 	return nil
 }
 
+// freeStack leaves the innermost alloc block. Its slots are dropped together
+// with its allocator; the slots of enclosing blocks are untouched.
 func (r *Runtime) freeStack() {
-	r.exprStack = nil
-	r.allocator = nil
-	r.slots = nil
+	n := len(r.arenas)
+	if n == 0 {
+		return
+	}
+	arena := r.arenas[n-1]
+	r.arenas = r.arenas[:n-1]
+	if n == 1 {
+		// The expression stack outlives the block; the next block's size
+		// is evaluated on it
+		r.exprStack.Reset()
+		r.allocator = nil
+		r.slots = nil
+		return
+	}
+	r.allocator = r.arenas[n-2].allocator
+	if arena.base < len(r.slots) {
+		r.slots = r.slots[:arena.base]
+	}
+}
+
+// popSize pops the capacity or growth ceiling of an alloc block.
+func (r *Runtime) popSize() (int, error) {
+	val, err := r.exprStack.Pop()
+	if err != nil {
+		return 0, err
+	}
+	size, ok := val.(value.Allocable)
+	if !ok {
+		return 0, fmt.Errorf("size value is not allocable")
+	}
+	return value.ToInt(size)
+}
+
+// popElementOffset pops an array index from the expression stack and returns
+// the byte offset of that element in the allocator. Every access is bounds
+// checked against the slot's element count.
+func (r *Runtime) popElementOffset(slotID int, tag value.TypeTag) (int, error) {
+	if slotID >= len(r.slots) || !r.slots[slotID].Alive {
+		return 0, fmt.Errorf("slot %d is not alive", slotID)
+	}
+	if r.exprStack == nil {
+		return 0, fmt.Errorf("undefined stack")
+	}
+
+	val, err := r.exprStack.Pop()
+	if err != nil {
+		return 0, err
+	}
+	alloc, ok := val.(value.Allocable)
+	if !ok {
+		return 0, fmt.Errorf("index value is not allocable")
+	}
+	index, err := value.ToInt(alloc)
+	if err != nil {
+		return 0, err
+	}
+
+	slot := r.slots[slotID]
+	if index < 0 || index >= slot.Length {
+		return 0, fmt.Errorf("index %d out of bounds for array of length %d", index, slot.Length)
+	}
+	return slot.Offset + index*value.SizeForTag(tag), nil
+}
+
+// stencilPair returns the two stencil slots addressed by Argument and Offset
+// of a STENCIL_COPY or STENCIL_EQ. Both must be alive and of equal size.
+func (r *Runtime) stencilPair(frame *CallFrame, instr compiler.Instruction) (SlotEntry, SlotEntry, error) {
+	var pair [2]SlotEntry
+	for i, id := range []int{instr.Argument, instr.Offset} {
+		slotID := frame.BasePointer + id
+		if slotID >= len(r.slots) || !r.slots[slotID].Alive {
+			return SlotEntry{}, SlotEntry{}, fmt.Errorf("slot %d is not alive", slotID)
+		}
+		if !r.slots[slotID].Stencil {
+			return SlotEntry{}, SlotEntry{}, fmt.Errorf("slot %d is not a stencil", slotID)
+		}
+		pair[i] = r.slots[slotID]
+	}
+	if pair[0].Size != pair[1].Size {
+		return SlotEntry{}, SlotEntry{}, fmt.Errorf("stencil size mismatch: %d and %d bytes", pair[0].Size, pair[1].Size)
+	}
+	return pair[0], pair[1], nil
+}
+
+// popString pops a string from the expression stack.
+func (r *Runtime) popString() (*value.StringSlice, error) {
+	val, err := r.exprStack.Pop()
+	if err != nil {
+		return nil, err
+	}
+	str, ok := val.(*value.StringSlice)
+	if !ok {
+		return nil, fmt.Errorf("expected string, got %s", val.Type())
+	}
+	return str, nil
+}
+
+// storeString writes str into a string slot as a 4-byte length prefix followed
+// by its bytes. The region is reused when it is large enough; otherwise a new
+// region is allocated before the old one is released, since str may still
+// view the old region. If that fails, str is copied out and the allocation is
+// retried with the old region released, so it can be merged with its neighbours.
+func (r *Runtime) storeString(slotID int, str *value.StringSlice) error {
+	if r.allocator == nil {
+		return fmt.Errorf("no allocator active")
+	}
+	slot := &r.slots[slotID]
+	memory := r.memory(*slot)
+	need := value.StringPrefixSize + str.Length()
+
+	if slot.Size < need {
+		// Allocating may compact the arena and move the bytes str views
+		str = value.NewStringView(bytes.Clone(str.View()))
+		offset, err := r.allocate(slot.Arena, need)
+		if err != nil && slot.Size > 0 {
+			if err := r.release(*slot); err != nil {
+				return err
+			}
+			slot.Size = 0
+			offset, err = r.allocate(slot.Arena, need)
+		}
+		if err != nil {
+			return err
+		}
+		copy(memory.Slice(offset+value.StringPrefixSize, str.Length()), str.View())
+		if slot.Size > 0 {
+			if err := r.release(*slot); err != nil {
+				return err
+			}
+		}
+		slot.Offset = offset
+		slot.Size = need
+		r.own(slotID)
+	} else {
+		copy(memory.Slice(slot.Offset+value.StringPrefixSize, str.Length()), str.View())
+	}
+
+	binary.LittleEndian.PutUint32(memory.Slice(slot.Offset, value.StringPrefixSize), uint32(str.Length()))
+	return nil
 }
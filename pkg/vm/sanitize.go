@@ -0,0 +1,78 @@
+package vm
+
+import "fmt"
+
+// In sanitize mode every arena keeps a shadow of its buffer with one owner
+// entry per byte: 0 for bytes no slot has held, id+1 for bytes of the live
+// slot id and -(id+1) for bytes slot id held before it was freed. Pointer
+// aliases own nothing; their loads and stores are checked against the
+// shadow instead, since they are the only way to reach bytes that no live
+// slot owns.
+
+// own marks the region of slot id as owned by it.
+func (r *Runtime) own(id int) {
+	if !r.sanitize {
+		return
+	}
+	slot := r.slots[id]
+	shadow := r.arenas[slot.Arena].shadow
+	for i := slot.Offset; i < slot.Offset+slot.Size; i++ {
+		shadow[i] = int32(id + 1)
+	}
+}
+
+// disown marks the region of slot as freed, remembering its last owner.
+func (r *Runtime) disown(slot SlotEntry) {
+	if !r.sanitize {
+		return
+	}
+	shadow := r.arenas[slot.Arena].shadow
+	for i := slot.Offset; i < slot.Offset+slot.Size; i++ {
+		if shadow[i] > 0 {
+			shadow[i] = -shadow[i]
+		}
+	}
+}
+
+// reshadow rebuilds the shadow of the arena at index from its live slots,
+// after they were moved or the buffer grew. Freed bytes lose their last
+// owner.
+func (r *Runtime) reshadow(index int) {
+	if !r.sanitize {
+		return
+	}
+	arena := &r.arenas[index]
+	arena.shadow = make([]int32, arena.allocator.Capacity())
+	for id, slot := range r.slots {
+		if slot.Arena == index && slot.Alive && !slot.Alias {
+			r.own(id)
+		}
+	}
+}
+
+// checkAlias fails when the alias slot id would load or store size bytes
+// that no live slot owns, or store across the regions of two slots.
+func (r *Runtime) checkAlias(id, size int, store bool) error {
+	if !r.sanitize {
+		return nil
+	}
+	slot := r.slots[id]
+	shadow := r.arenas[slot.Arena].shadow
+	access := "loads"
+	if store {
+		access = "stores"
+	}
+
+	first := shadow[slot.Offset]
+	for i := slot.Offset; i < slot.Offset+size; i++ {
+		switch owner := shadow[i]; {
+		case owner == 0:
+			return fmt.Errorf("sanitize: alias slot %d %s unowned byte at offset %d", id, access, i)
+		case owner < 0:
+			return fmt.Errorf("sanitize: alias slot %d %s freed byte at offset %d of slot %d", id, access, i, -owner-1)
+		case store && owner != first:
+			return fmt.Errorf("sanitize: alias slot %d stores across slot %d and slot %d at offset %d", id, first-1, owner-1, slot.Offset)
+		}
+	}
+	return nil
+}
@@ -14,11 +14,30 @@ import (
 
 const (
 	MaxFrames = 256
+
+	// DefaultMaxAllocSize is the default limit for the combined capacity of
+	// all live alloc blocks, the same as the compiler's.
+	DefaultMaxAllocSize = compiler.DefaultMaxAllocSize
 )
 
+// ArenaGrowth describes one reallocation of a growable alloc block, such as
+// 'alloc 64 grow 4096 { ... }'.
+type ArenaGrowth struct {
+	Line    int // source line of the allocation that did not fit
+	Depth   int // nesting depth of the block, 0 for the outermost
+	From    int // capacity before growing
+	To      int // capacity after growing
+	Ceiling int // capacity the block may grow to
+	Count   int // growths of this block so far, including this one
+}
+
 type VM struct {
-	mu sync.RWMutex
-	fs vfs.VirtualFileSystem
+	mu       sync.RWMutex
+	fs       vfs.VirtualFileSystem
+	maxAlloc int
+	onGrowth func(ArenaGrowth)
+	sanitize bool
+	leaks    bool
 
 	stdin  io.Reader
 	stdout io.Writer
@@ -29,7 +48,8 @@ var _ VirtualMachine = (*VM)(nil)
 
 func NewVM(fs vfs.VirtualFileSystem) VirtualMachine {
 	return &VM{
-		fs: fs,
+		fs:       fs,
+		maxAlloc: DefaultMaxAllocSize,
 
 		stdin:  bytes.NewBuffer(nil),
 		stdout: io.Discard,
@@ -53,7 +73,8 @@ func NewEphemeralVM() (VirtualMachine, error) {
 	}
 
 	return &VM{
-		fs: fs,
+		fs:       fs,
+		maxAlloc: DefaultMaxAllocSize,
 
 		stdin:  bytes.NewBuffer(nil),
 		stdout: io.Discard,
@@ -67,8 +88,13 @@ func (v *VM) Run(ctx context.Context, bytecode *compiler.ByteCode) (int, error)
 	defer v.mu.Unlock()
 	// Create initial call frame
 	runtime := &Runtime{
-		Frames: make([]*CallFrame, MaxFrames),
-		Index:  0,
+		Frames:    make([]*CallFrame, MaxFrames),
+		Index:     0,
+		exprStack: &ExprStack{},
+		maxAlloc:  v.maxAlloc,
+		onGrowth:  v.onGrowth,
+		sanitize:  v.sanitize,
+		leakCheck: v.leaks,
 		native: &Native{
 			Stdin:  v.stdin,
 			Stdout: v.stdout,
@@ -87,6 +113,37 @@ func (v *VM) Run(ctx context.Context, bytecode *compiler.ByteCode) (int, error)
 	return 0, nil
 }
 
+// MaxAllocSize implements VirtualMachine.
+func (v *VM) MaxAllocSize(size int) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if size > 0 {
+		v.maxAlloc = size
+	}
+	return v.maxAlloc
+}
+
+// OnArenaGrowth implements VirtualMachine.
+func (v *VM) OnArenaGrowth(fn func(ArenaGrowth)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.onGrowth = fn
+}
+
+// SetSanitize implements VirtualMachine.
+func (v *VM) SetSanitize(enabled bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.sanitize = enabled
+}
+
+// SetLeakCheck implements VirtualMachine.
+func (v *VM) SetLeakCheck(enabled bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.leaks = enabled
+}
+
 // Stdin implements VirtualMachine.
 func (v *VM) Stdin(stdin io.Reader) io.Reader {
 	if stdin != nil {